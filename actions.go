@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// alertMuteDuration is how long the "mute this alert" button mutes an alert.
+const alertMuteDuration = time.Hour
+
+// postKeyboard builds the action buttons of a post notification.
+//
+// Parameters:
+//
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The post.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	*models.InlineKeyboardMarkup: The inline keyboard of the notification.
+func postKeyboard(alert Alert, post divar.PostWidget, lang string) *models.InlineKeyboardMarkup {
+	postData := fmt.Sprintf("%d-%s", alert.Id, post.Data.Token)
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{
+			{Text: tr(lang, "button.open"), URL: postURL(post.Data.Token)},
+		},
+		{
+			{Text: tr(lang, "button.mute"), CallbackData: "mute_alert-" + strconv.FormatInt(alert.Id, 10)},
+			{Text: tr(lang, "button.hide"), CallbackData: "hide_post-" + postData},
+		},
+		{
+			{Text: tr(lang, "button.save"), CallbackData: "save_post-" + postData},
+			{Text: tr(lang, "button.track"), CallbackData: "track_price-" + postData},
+		},
+	}}
+}
+
+// parsePostCallback reads the alert ID and post token of a post action button.
+//
+// Parameters:
+//
+//	data (string): The callback data, e.g. "save_post-<alertId>-<token>".
+//	prefix (string): The callback data prefix that precedes the alert ID.
+//
+// Returns:
+//
+//	int64: The ID of the alert that matched the post.
+//	string: The token of the post.
+//	error: An error if the callback data is malformed, otherwise nil.
+func parsePostCallback(data string, prefix string) (int64, string, error) {
+	id, token, ok := strings.Cut(strings.TrimPrefix(data, prefix), "-")
+	if !ok || token == "" {
+		return 0, "", fmt.Errorf("invalid post callback data %q", data)
+	}
+	alertId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return alertId, token, nil
+}
+
+// getSeenPost reads a post from the seen marker stored when the alert found it.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	token (string): The token of the post.
+//	alertId (int64): The ID of the alert that found the post.
+//
+// Returns:
+//
+//	divar.PostWidget: The post as it was found.
+//	error: An error if the post was not found or cannot be decoded, otherwise nil.
+func getSeenPost(txn *badger.Txn, token string, alertId int64) (divar.PostWidget, error) {
+	var post divar.PostWidget
+	item, err := txn.Get([]byte(fmt.Sprintf("post-%s-%d", token, alertId)))
+	if err != nil {
+		return post, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &post)
+	})
+	return post, err
+}
+
+// saveSeenPost stores the seen marker of a post found by an alert.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	key ([]byte): The key of the marker, "post-<token>-<alertId>".
+//	seen (SeenPost): The post and whether the chat got it.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func saveSeenPost(txn *badger.Txn, key []byte, seen SeenPost) error {
+	value, err := json.Marshal(seen)
+	if err != nil {
+		return err
+	}
+	return txn.Set(key, value)
+}
+
+// hideSignature builds the text under which similar posts are hidden: the title without its
+// numbers, which sellers change when they post again, and the district of the post.
+//
+// Parameters:
+//
+//	title (string): The title of the post.
+//	district (string): The district of the post, empty to hide the title in every district.
+//
+// Returns:
+//
+//	string: The signature of the post.
+func hideSignature(title string, district string) string {
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return ' '
+		}
+		return r
+	}, divar.NormalizeDigits(title))
+	return normalizeKeywordText(title) + "|" + normalizeKeywordText(district)
+}
+
+// hiddenKey builds the database key that hides the posts of a chat with a similar title in a district.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	title (string): The title of the post.
+//	district (string): The district of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the hidden posts.
+func hiddenKey(botName string, chatId int64, title string, district string) []byte {
+	sum := sha256.Sum256([]byte(hideSignature(title, district)))
+	return []byte(fmt.Sprintf("hidden-%s-%s", chatScope(botName, chatId), hex.EncodeToString(sum[:16])))
+}
+
+// hiddenValue builds the value of a hidden key, from which the key can be built again.
+//
+// Parameters:
+//
+//	title (string): The title of the post.
+//	district (string): The district of the post.
+//
+// Returns:
+//
+//	[]byte: The title and the district on separate lines.
+func hiddenValue(title string, district string) []byte {
+	return []byte(title + "\n" + district)
+}
+
+// isHidden reports whether the chat marked a post with a similar title in the same district as not interesting.
+// Titles hidden without a district, before districts were recorded, are hidden in every district.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	bool: True if the post is hidden, otherwise false.
+func isHidden(txn *badger.Txn, botName string, chatId int64, post divar.PostWidget) bool {
+	district := post.Data.Action.Payload.WebInfo.DistrictPersian
+	_, err := txn.Get(hiddenKey(botName, chatId, post.Data.Title, district))
+	if errors.Is(err, badger.ErrKeyNotFound) && district != "" {
+		_, err = txn.Get(hiddenKey(botName, chatId, post.Data.Title, ""))
+	}
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		sugar.Errorw("Failed to read hidden posts", "error", err, "chat", chatId)
+	}
+	return err == nil
+}
+
+// trackedKey builds the database key under which a price tracked post of a chat is stored.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the tracked post.
+func trackedKey(botName string, chatId int64, token string) []byte {
+	return []byte(fmt.Sprintf("tracked-%s-%s", chatScope(botName, chatId), token))
+}
+
+// checkTrackedPrice compares the price of a listed post with the price last seen,
+// if the chat of the alert tracks it, and queues a notification when it changed.
+// While the alert or the chat is muted the last seen price is kept, so the change is
+// sent once the mute is over. During quiet hours the change is deferred like new posts.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that listed the post.
+//	post (divar.PostWidget): The post as currently listed.
+//	muted (bool): Whether the alert or the chat is muted.
+//	quiet (bool): Whether the chat is in its quiet hours.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func checkTrackedPrice(txn *badger.Txn, alert Alert, post divar.PostWidget, muted bool, quiet bool) error {
+	if muted {
+		return nil
+	}
+	item, err := txn.Get(trackedKey(alert.Bot, alert.ChatId, post.Data.Token))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var tracked TrackedPost
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &tracked)
+	})
+	if err != nil {
+		return err
+	}
+
+	price := postPrice(post)
+	if price == "" || price == tracked.Price {
+		return nil
+	}
+	previousPrice := tracked.Price
+	tracked.Price = price
+	tracked.Post = post
+	value, err := json.Marshal(tracked)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(item.KeyCopy(nil), value); err != nil {
+		return err
+	}
+
+	if quiet {
+		note := tr(chatLang(alert.Bot, alert.ChatId), priceChangeKey(previousPrice, price), previousPrice, price)
+		_, err = deferPostWithNote(txn, alert, post, note)
+		return err
+	}
+	recipient := Recipient{Channel: Channel.Bot, Bot: tracked.Bot, ChatId: alert.ChatId}
+	_, err = enqueueNotification(txn, PostNotification{Alert: alert, Post: post, PreviousPrice: previousPrice}, []Recipient{recipient})
+	return err
+}
+
+func handlerCallbackMuteAlert(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, err := strconv.ParseInt(update.CallbackQuery.Data[len("mute_alert-"):], 10, 64)
+	var alert Alert
+	if err == nil {
+		alert, err = updateAlert(botName(b), chatId, alertId, func(alert *Alert) error {
+			alert.MutedUntil = time.Now().Add(alertMuteDuration).Unix()
+			return nil
+		})
+	}
+	text := tr(lang, "action.mute.done", alert.Title)
+	if err != nil {
+		sugar.Errorw("Failed to mute alert", "error", err)
+		text = tr(lang, "action.error")
+	}
+
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+	})
+}
+
+func handlerCallbackHidePost(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, token, err := parsePostCallback(update.CallbackQuery.Data, "hide_post-")
+	if err == nil {
+		err = db.Update(func(txn *badger.Txn) error {
+			post, err := getSeenPost(txn, token, alertId)
+			if err != nil {
+				return err
+			}
+			district := post.Data.Action.Payload.WebInfo.DistrictPersian
+			return txn.Set(hiddenKey(botName(b), chatId, post.Data.Title, district), hiddenValue(post.Data.Title, district))
+		})
+	}
+	text := tr(lang, "action.hide.done")
+	if err != nil {
+		sugar.Errorw("Failed to hide post", "error", err)
+		text = tr(lang, "action.error")
+	}
+
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+	})
+}
+
+func handlerCallbackSavePost(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, token, err := parsePostCallback(update.CallbackQuery.Data, "save_post-")
+	if err == nil {
+		err = db.Update(func(txn *badger.Txn) error {
+			post, err := getSeenPost(txn, token, alertId)
+			if err != nil {
+				return err
+			}
+			if err := keepListingHistory(txn, post); err != nil {
+				return err
+			}
+			favorite := Favorite{Bot: botName(b), Token: token, Post: post, SavedAt: time.Now().Unix()}
+			if alert, err := getAlert(txn, botName(b), chatId, alertId); err == nil {
+				favorite.AlertTitle = alert.Title
+			}
+			value, err := json.Marshal(favorite)
+			if err != nil {
+				return err
+			}
+			return txn.Set(favoriteKey(botName(b), chatId, token), value)
+		})
+	}
+	text := tr(lang, "action.save.done")
+	if err != nil {
+		sugar.Errorw("Failed to save post", "error", err)
+		text = tr(lang, "action.error")
+	}
+
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+	})
+}
+
+func handlerCallbackTrackPrice(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, token, err := parsePostCallback(update.CallbackQuery.Data, "track_price-")
+	if err == nil {
+		err = db.Update(func(txn *badger.Txn) error {
+			alert, err := getAlert(txn, botName(b), chatId, alertId)
+			if err != nil {
+				return err
+			}
+			post, err := getSeenPost(txn, token, alertId)
+			if err != nil {
+				return err
+			}
+			if err := keepListingHistory(txn, post); err != nil {
+				return err
+			}
+			value, err := json.Marshal(TrackedPost{
+				Bot:        botName(b),
+				AlertId:    alert.Id,
+				AlertTitle: alert.Title,
+				Post:       post,
+				Price:      postPrice(post),
+				TrackedAt:  time.Now().Unix(),
+			})
+			if err != nil {
+				return err
+			}
+			return txn.Set(trackedKey(botName(b), chatId, token), value)
+		})
+	}
+	text := tr(lang, "action.track.done")
+	if err != nil {
+		sugar.Errorw("Failed to track post price", "error", err)
+		text = tr(lang, "action.error")
+	}
+
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+	})
+}
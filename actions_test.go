@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+)
+
+// districtPost builds a post with the given title in a district.
+func districtPost(token string, title string, district string) divar.PostWidget {
+	post := testPost(token, title)
+	post.Data.Action.Payload.WebInfo.DistrictPersian = district
+	return post
+}
+
+func TestHideSignature(t *testing.T) {
+	same := [][2]string{
+		{"آپارتمان ۸۵ متری طبقه ۳", "آپارتمان 90 متری طبقه 2"},
+		{"آپارتمان  نوساز", "آپارتمان نوساز"},
+		{"آپارتمان ۸۵ متری", "آپارتمان ٩٠ متري"},
+	}
+	for _, titles := range same {
+		if hideSignature(titles[0], "ونک") != hideSignature(titles[1], "ونک") {
+			t.Errorf("%q and %q have different signatures", titles[0], titles[1])
+		}
+	}
+	if hideSignature("آپارتمان نوساز", "ونک") == hideSignature("آپارتمان نوساز", "پونک") {
+		t.Error("the same title in another district has the same signature")
+	}
+	if hideSignature("آپارتمان نوساز", "ونک") == hideSignature("ویلا نوساز", "ونک") {
+		t.Error("another title has the same signature")
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	openTestDB(t)
+	err := db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(hiddenKey("telegram", 10, "آپارتمان ۸۵ متری", "ونک"), hiddenValue("آپارتمان ۸۵ متری", "ونک")); err != nil {
+			return err
+		}
+		// hidden before districts were recorded
+		return txn.Set(hiddenKey("telegram", 10, "ویلا", ""), hiddenValue("ویلا", ""))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		post divar.PostWidget
+		want bool
+	}{
+		{"same title", districtPost("a", "آپارتمان ۸۵ متری", "ونک"), true},
+		{"other numbers", districtPost("b", "آپارتمان ۹۰ متری", "ونک"), true},
+		{"other district", districtPost("c", "آپارتمان ۸۵ متری", "پونک"), false},
+		{"other title", districtPost("d", "آپارتمان نوساز", "ونک"), false},
+		{"title hidden in every district", districtPost("e", "ویلا", "پونک"), true},
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		for _, test := range tests {
+			if got := isHidden(txn, "telegram", 10, test.post); got != test.want {
+				t.Errorf("%s: isHidden() = %v, want %v", test.name, got, test.want)
+			}
+			if isHidden(txn, "bale", 10, test.post) {
+				t.Errorf("%s: hidden for the chat of another bot", test.name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckTrackedPriceWhileMutedOrQuiet(t *testing.T) {
+	openTestDB(t)
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats"}
+	value, err := json.Marshal(TrackedPost{Bot: "telegram", AlertId: 1, Post: pricedPost("a", "۲ میلیارد تومان"), Price: "۲ میلیارد تومان"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(price string, muted bool, quiet bool) {
+		t.Helper()
+		err := db.Update(func(txn *badger.Txn) error {
+			return checkTrackedPrice(txn, alert, pricedPost("a", price), muted, quiet)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set(trackedKey("telegram", 10, "a"), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the change is kept for after the mute
+	check("۱٫۸ میلیارد تومان", true, false)
+	if outbox, _ := readOutbox(); len(outbox) != 0 {
+		t.Fatalf("a change was queued while muted: %+v", outbox)
+	}
+
+	check("۱٫۸ میلیارد تومان", false, true)
+	if outbox, _ := readOutbox(); len(outbox) != 0 {
+		t.Fatalf("a change was sent during quiet hours: %+v", outbox)
+	}
+	deferred, err := readQueue("deferred-" + chatScope("telegram", 10) + "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tr(defaultLang, "price.dropped", "۲ میلیارد تومان", "۱٫۸ میلیارد تومان")
+	if len(deferred) != 1 || deferred[0].post.Note != want {
+		t.Fatalf("deferred = %+v, want the drop with the note %q", deferred, want)
+	}
+
+	check("۱٫۵ میلیارد تومان", false, false)
+	outbox, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].PreviousPrice != "۱٫۸ میلیارد تومان" {
+		t.Errorf("outbox = %+v, want the drop from the deferred price", outbox)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertKey builds the database key under which an alert is stored.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot the alert was created on.
+//	chatId (int64): The ID of the chat that owns the alert.
+//	alertId (int64): The ID of the alert.
+//
+// Returns:
+//
+//	[]byte: The database key of the alert.
+func alertKey(botName string, chatId int64, alertId int64) []byte {
+	return []byte(fmt.Sprintf("alert-%s-%d", chatScope(botName, chatId), alertId))
+}
+
+// getAlert reads an alert from the database within the given transaction.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	botName (string): The name of the bot the alert was created on.
+//	chatId (int64): The ID of the chat that owns the alert.
+//	alertId (int64): The ID of the alert.
+//
+// Returns:
+//
+//	Alert: The stored alert.
+//	error: An error if the alert does not exist or cannot be decoded, otherwise nil.
+func getAlert(txn *badger.Txn, botName string, chatId int64, alertId int64) (Alert, error) {
+	var alert Alert
+	item, err := txn.Get(alertKey(botName, chatId, alertId))
+	if err != nil {
+		return Alert{}, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &alert)
+	})
+	if err != nil {
+		return Alert{}, err
+	}
+	return alert, nil
+}
+
+// saveAlert writes an alert to the database within the given transaction.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert to be saved.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func saveAlert(txn *badger.Txn, alert Alert) error {
+	value, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return txn.Set(alertKey(alert.Bot, alert.ChatId, alert.Id), value)
+}
+
+// listAlerts reads all alerts of a chat on a bot, in the order they were created.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	[]Alert: The alerts of the chat.
+//	error: An error if the alerts cannot be read, otherwise nil.
+func listAlerts(botName string, chatId int64) ([]Alert, error) {
+	var alerts []Alert
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("alert-" + chatScope(botName, chatId) + "-")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			var alert Alert
+			err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &alert)
+			})
+			if err != nil {
+				return err
+			}
+			alerts = append(alerts, alert)
+		}
+		return nil
+	})
+	return alerts, err
+}
+
+// updateAlert loads an alert, applies the given change to it and saves it back.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot the alert was created on.
+//	chatId (int64): The ID of the chat that owns the alert.
+//	alertId (int64): The ID of the alert.
+//	change (func(*Alert) error): The function that modifies the alert, the alert is not saved if it fails.
+//
+// Returns:
+//
+//	Alert: The updated alert.
+//	error: An error if the operation fails, otherwise nil.
+func updateAlert(botName string, chatId int64, alertId int64, change func(*Alert) error) (Alert, error) {
+	var alert Alert
+	err := db.Update(func(txn *badger.Txn) error {
+		var err error
+		alert, err = getAlert(txn, botName, chatId, alertId)
+		if err != nil {
+			return err
+		}
+		if err := change(&alert); err != nil {
+			return err
+		}
+		return saveAlert(txn, alert)
+	})
+	return alert, err
+}
+
+// isMuted reports whether the new posts of an alert are recorded as seen without being sent:
+// on the first check after a resume that marks them seen, while the chat is snoozed, or
+// while the alert is muted. A snooze or mute ends at its timestamp.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//	chat (Chat): The settings of the chat of the alert.
+//	now (time.Time): The moment to check.
+//
+// Returns:
+//
+//	bool: True if the posts are not sent, otherwise false.
+func isMuted(alert Alert, chat Chat, now time.Time) bool {
+	return alert.MarkSeenOnce || chat.SnoozeUntil > now.Unix() || alert.MutedUntil > now.Unix()
+}
+
+func handlerCallbackPauseAlert(ctx context.Context, b *bot.Bot, update *models.Update) {
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	})
+
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, err := strconv.ParseInt(update.CallbackQuery.Data[len("pause_alert-"):], 10, 64)
+	if err == nil {
+		_, err = updateAlert(botName(b), chatId, alertId, func(alert *Alert) error {
+			alert.Paused = true
+			alert.PausedAt = time.Now().Unix()
+			return nil
+		})
+	}
+	if err != nil {
+		sugar.Errorw("Failed to pause alert", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "alert.pause.error"),
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   tr(lang, "alert.pause.done"),
+	})
+}
+
+func handlerCallbackResumeAlert(ctx context.Context, b *bot.Bot, update *models.Update) {
+	resumeAlert(ctx, b, update, "resume_alert-", false)
+}
+
+func handlerCallbackResumeAlertMarkSeen(ctx context.Context, b *bot.Bot, update *models.Update) {
+	resumeAlert(ctx, b, update, "resume_alert_seen-", true)
+}
+
+// resumeAlert resumes a paused alert selected by an inline button.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the update.
+//	b (*bot.Bot): The bot that received the update.
+//	update (*models.Update): The callback query update.
+//	prefix (string): The callback data prefix that precedes the alert ID.
+//	markSeen (bool): Whether posts published during the pause should be marked as seen instead of being sent.
+func resumeAlert(ctx context.Context, b *bot.Bot, update *models.Update, prefix string, markSeen bool) {
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	})
+
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alertId, err := strconv.ParseInt(update.CallbackQuery.Data[len(prefix):], 10, 64)
+	if err == nil {
+		_, err = updateAlert(botName(b), chatId, alertId, func(alert *Alert) error {
+			alert.Paused = false
+			alert.MarkSeenOnce = markSeen
+			// check right away so the state catches up with the pause
+			alert.LastTimeChecked = 0
+			return nil
+		})
+	}
+	if err != nil {
+		sugar.Errorw("Failed to resume alert", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "alert.resume.error"),
+		})
+		return
+	}
+
+	text := tr(lang, "alert.resume.done")
+	if markSeen {
+		text = tr(lang, "alert.resume.doneSeen")
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   text,
+	})
+}
+
+// alertField is a setting of an alert that can be changed with /alertEdit.
+//
+// Fields:
+//
+//	Name (string): The name the user enters to select the setting.
+//	Description (string): The catalog key of the help shown to the user.
+//	Set (func(*Alert, string) error): The function that validates the entered value and applies it.
+type alertField struct {
+	Name        string
+	Description string
+	Set         func(alert *Alert, value string) error
+}
+
+// alertFields holds the settings of an alert that can be changed with /alertEdit.
+var alertFields = []alertField{
+	{
+		Name:        "webhook",
+		Description: "field.webhook",
+		Set:         setAlertWebhook,
+	},
+	{
+		Name:        "webhookSecret",
+		Description: "field.webhookSecret",
+		Set:         setAlertWebhookSecret,
+	},
+	{
+		Name:        "email",
+		Description: "field.email",
+		Set:         setAlertEmail,
+	},
+	{
+		Name:        "template",
+		Description: "field.template",
+		Set:         setAlertTemplate,
+	},
+	{
+		Name:        "album",
+		Description: "field.album",
+		Set:         setAlertAlbum,
+	},
+	{
+		Name:        "include",
+		Description: "field.include",
+		Set:         setAlertInclude,
+	},
+	{
+		Name:        "exclude",
+		Description: "field.exclude",
+		Set:         setAlertExclude,
+	},
+	{
+		Name:        "regex",
+		Description: "field.regex",
+		Set:         setAlertRegex,
+	},
+	{
+		Name:        "rule",
+		Description: "field.rule",
+		Set:         setAlertRule,
+	},
+	{
+		Name:        "reposts",
+		Description: "field.reposts",
+		Set:         setAlertReposts,
+	},
+	{
+		Name:        "priceChanges",
+		Description: "field.priceChanges",
+		Set:         setAlertPriceChanges,
+	},
+	{
+		Name:        "dealPercentile",
+		Description: "field.dealPercentile",
+		Set:         setAlertDealPercentile,
+	},
+}
+
+// findAlertField returns the editable setting with the given name.
+//
+// Parameters:
+//
+//	name (string): The name of the setting.
+//
+// Returns:
+//
+//	alertField: The setting.
+//	bool: True if the setting exists, otherwise false.
+func findAlertField(name string) (alertField, bool) {
+	for _, field := range alertFields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return alertField{}, false
+}
+
+func handlerAlertEdit(ctx context.Context, b *bot.Bot, update *models.Update) {
+	lang := chatLang(botName(b), update.Message.Chat.ID)
+	p, err := ProcessStart(ProcessKey.EditAlert, update.Message.Chat.ID, botName(b), lang, db)
+	if err != nil {
+		sugar.Errorw("Failed to start edit alert process", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   tr(lang, "alert.edit.startError"),
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   p.Step[p.CurrentStepIndex].Message,
+	})
+}
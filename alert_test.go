@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+	"time"
+)
+
+func TestIsMuted(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		alert Alert
+		chat  Chat
+		want  bool
+	}{
+		{"not muted", Alert{}, Chat{}, false},
+		{"snoozed", Alert{}, Chat{SnoozeUntil: now.Add(time.Minute).Unix()}, true},
+		{"snooze ends now", Alert{}, Chat{SnoozeUntil: now.Unix()}, false},
+		{"snooze over", Alert{}, Chat{SnoozeUntil: now.Add(-time.Minute).Unix()}, false},
+		{"alert muted", Alert{MutedUntil: now.Add(time.Hour).Unix()}, Chat{}, true},
+		{"alert mute over", Alert{MutedUntil: now.Add(-time.Hour).Unix()}, Chat{}, false},
+		{"resumed marking posts seen", Alert{MarkSeenOnce: true}, Chat{}, true},
+	}
+	for _, test := range tests {
+		if got := isMuted(test.alert, test.chat, now); got != test.want {
+			t.Errorf("%s: isMuted() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckAlertsAfterSnooze(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link"}
+	saveTestAlert(t, alert)
+	if _, err := updateChat("telegram", 10, func(chat *Chat) { chat.SnoozeUntil = time.Now().Add(time.Hour).Unix() }); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := []divar.PostWidget{testPost("a", "flat")}
+	search := func(link string) (divar.SearchRes, error) {
+		return divar.SearchRes{ListWidgets: listed}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+	if outbox, _ := readOutbox(); len(outbox) != 0 {
+		t.Fatalf("a post was sent while snoozed: %+v", outbox)
+	}
+
+	// once the snooze is over, only the posts found since then are sent
+	if _, err := updateChat("telegram", 10, func(chat *Chat) { chat.SnoozeUntil = time.Now().Add(-time.Minute).Unix() }); err != nil {
+		t.Fatal(err)
+	}
+	saveTestAlert(t, alert)
+	listed = []divar.PostWidget{testPost("b", "newer flat"), testPost("a", "flat")}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+	outbox, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].Post.Data.Token != "b" {
+		t.Errorf("outbox = %+v, want only the post found after the snooze", outbox)
+	}
+}
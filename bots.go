@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultBotName is the name of the bot configured by TELEGRAM_BOT_TOKEN and TELEGRAM_API_URL.
+const defaultBotName = "default"
+
+// botNamePattern matches the valid bot names. Names are part of database keys, so they
+// start with a letter and cannot hold the separators of those keys.
+var botNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// BotConfig holds the settings of one bot instance.
+//
+// Fields:
+//
+//	Name (string): The name of the bot, stored on its alerts.
+//	Token (string): The token of the bot.
+//	ApiUrl (string): The URL of the Telegram or Bale bot API.
+type BotConfig struct {
+	Name   string
+	Token  string
+	ApiUrl string
+}
+
+// botInstance is a running bot together with its send limiter.
+type botInstance struct {
+	Name    string
+	Bot     *bot.Bot
+	Limiter *sendLimiter
+}
+
+// bots holds the running bots, the first one being the default.
+var bots []*botInstance
+
+// loadBotConfigs reads the bot settings from the environment.
+// BOTS lists the names of the bots, e.g. "telegram,bale", each configured by
+// <NAME>_BOT_TOKEN and <NAME>_API_URL. Without BOTS a single bot is configured
+// by TELEGRAM_BOT_TOKEN and TELEGRAM_API_URL.
+//
+// Returns:
+//
+//	[]BotConfig: The settings of the bots.
+//	error: An error if a bot is not fully configured, otherwise nil.
+func loadBotConfigs() ([]BotConfig, error) {
+	names := os.Getenv("BOTS")
+	if names == "" {
+		config := BotConfig{
+			Name:   defaultBotName,
+			Token:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+			ApiUrl: os.Getenv("TELEGRAM_API_URL"),
+		}
+		if config.Token == "" || config.ApiUrl == "" {
+			return nil, errors.New("TELEGRAM_API_URL and TELEGRAM_BOT_TOKEN must be set in .env file")
+		}
+		return []BotConfig{config}, nil
+	}
+
+	var configs []BotConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !botNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("bot name %q must start with a letter and hold only letters, digits and underscores", name)
+		}
+		prefix := strings.ToUpper(name)
+		config := BotConfig{
+			Name:   name,
+			Token:  os.Getenv(prefix + "_BOT_TOKEN"),
+			ApiUrl: os.Getenv(prefix + "_API_URL"),
+		}
+		if config.Token == "" || config.ApiUrl == "" {
+			return nil, fmt.Errorf("%s_API_URL and %s_BOT_TOKEN must be set in .env file", prefix, prefix)
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("BOTS does not name any bot")
+	}
+	return configs, nil
+}
+
+// errUnknownBot is returned when a notification names a bot that is not configured.
+var errUnknownBot = fmt.Errorf("%w: bot is not configured", errUndeliverable)
+
+// findBot returns the bot with the given name. Chat IDs of different bots are unrelated,
+// so an item of a bot that is no longer configured cannot be delivered by another one.
+//
+// Parameters:
+//
+//	name (string): The name of the bot.
+//
+// Returns:
+//
+//	*botInstance: The bot.
+//	bool: False if no bot with that name is configured.
+func findBot(name string) (*botInstance, bool) {
+	for _, instance := range bots {
+		if instance.Name == name {
+			return instance, true
+		}
+	}
+	return nil, false
+}
+
+// botName returns the name of the bot that received an update.
+//
+// Parameters:
+//
+//	b (*bot.Bot): The bot passed to a handler.
+//
+// Returns:
+//
+//	string: The name of the bot.
+func botName(b *bot.Bot) string {
+	for _, instance := range bots {
+		if instance.Bot == b {
+			return instance.Name
+		}
+	}
+	return bots[0].Name
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartWidth and chartHeight are the size of the rendered charts in pixels.
+const (
+	chartWidth  = 960
+	chartHeight = 540
+)
+
+// chartDefaultDays and chartMaxDays are the default and longest periods of /chart, in days.
+const (
+	chartDefaultDays = 30
+	chartMaxDays     = 90
+)
+
+// chartMargin is the space around the plot area, where the axis labels are drawn.
+var chartMargin = struct {
+	Left, Right, Top, Bottom int
+}{Left: 90, Right: 24, Top: 24, Bottom: 50}
+
+// chartColors holds the colors of the parts of a chart.
+var chartColors = struct {
+	Background color.RGBA
+	Grid       color.RGBA
+	Axis       color.RGBA
+	Label      color.RGBA
+	Point      color.RGBA
+	Median     color.RGBA
+}{
+	Background: color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	Grid:       color.RGBA{R: 228, G: 228, B: 232, A: 255},
+	Axis:       color.RGBA{R: 120, G: 120, B: 128, A: 255},
+	Label:      color.RGBA{R: 60, G: 60, B: 68, A: 255},
+	Point:      color.RGBA{R: 96, G: 146, B: 220, A: 255},
+	Median:     color.RGBA{R: 214, G: 69, B: 65, A: 255},
+}
+
+// chartGlyphs is a 5x7 bitmap font of the characters of axis labels. Each row is
+// 5 bits wide, with the leftmost pixel in the highest bit.
+var chartGlyphs = map[rune][7]uint8{
+	'0': {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1': {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3': {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4': {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5': {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6': {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8': {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9': {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	'-': {0b00000, 0b00000, 0b00000, 0b11111, 0b00000, 0b00000, 0b00000},
+	'.': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b01100},
+	'k': {0b10000, 0b10000, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010},
+	'M': {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'B': {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+}
+
+// chartPoint is a value of a chart at a time.
+type chartPoint struct {
+	At    time.Time
+	Value float64
+}
+
+// chartCanvas draws the parts of a chart on an image.
+type chartCanvas struct {
+	img *image.RGBA
+}
+
+// fillRect fills the pixels from (x0, y0) up to, but not including, (x1, y1).
+func (c chartCanvas) fillRect(x0, y0, x1, y1 int, col color.RGBA) {
+	for y := max(y0, 0); y < min(y1, chartHeight); y++ {
+		for x := max(x0, 0); x < min(x1, chartWidth); x++ {
+			c.img.SetRGBA(x, y, col)
+		}
+	}
+}
+
+// fillCircle fills a circle of a radius around a point.
+func (c chartCanvas) fillCircle(cx, cy, r int, col color.RGBA) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				c.fillRect(cx+x, cy+y, cx+x+1, cy+y+1, col)
+			}
+		}
+	}
+}
+
+// drawLine draws a line of a width between two points.
+func (c chartCanvas) drawLine(x0, y0, x1, y1, width int, col color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		c.fillRect(x-width/2, y-width/2, x-width/2+width, y-width/2+width, col)
+	}
+}
+
+// drawText draws a label with chartGlyphs, scaled, with its top left corner at a point.
+func (c chartCanvas) drawText(x, y int, text string, scale int, col color.RGBA) {
+	for _, char := range text {
+		glyph := chartGlyphs[char]
+		for row, bits := range glyph {
+			for column := 0; column < 5; column++ {
+				if bits&(1<<(4-column)) != 0 {
+					px, py := x+column*scale, y+row*scale
+					c.fillRect(px, py, px+scale, py+scale, col)
+				}
+			}
+		}
+		x += 6 * scale
+	}
+}
+
+// textWidth returns the width in pixels of a label drawn by drawText.
+func textWidth(text string, scale int) int {
+	return (6*len([]rune(text)) - 1) * scale
+}
+
+// abs returns the absolute value of an integer.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// compactAmount formats an amount for an axis label, e.g. "85.5M" or "1.2B".
+//
+// Parameters:
+//
+//	amount (float64): The amount.
+//
+// Returns:
+//
+//	string: The amount with a k, M or B suffix.
+func compactAmount(amount float64) string {
+	suffix := ""
+	for _, scale := range []struct {
+		Value  float64
+		Suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "k"}} {
+		if math.Abs(amount) >= scale.Value {
+			amount /= scale.Value
+			suffix = scale.Suffix
+			break
+		}
+	}
+	text := strconv.FormatFloat(amount, 'f', 1, 64)
+	return strings.TrimSuffix(text, ".0") + suffix
+}
+
+// niceStep rounds the distance between axis ticks up to 1, 2 or 5 times a power of ten.
+//
+// Parameters:
+//
+//	step (float64): The raw distance between ticks.
+//
+// Returns:
+//
+//	float64: The rounded distance.
+func niceStep(step float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, factor := range []float64{1, 2, 5} {
+		if step <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// dailyMedians computes the median value of each day, in Tehran time.
+//
+// Parameters:
+//
+//	points ([]chartPoint): The values.
+//
+// Returns:
+//
+//	[]chartPoint: The median of each day with values, at noon of the day, oldest first.
+func dailyMedians(points []chartPoint) []chartPoint {
+	days := map[time.Time][]float64{}
+	for _, point := range points {
+		t := point.At.In(tehran)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, tehran)
+		days[day] = append(days[day], point.Value)
+	}
+	var medians []chartPoint
+	for day, values := range days {
+		medians = append(medians, chartPoint{At: day, Value: summarizeAmounts(values).Median})
+	}
+	slices.SortFunc(medians, func(a, b chartPoint) int {
+		return a.At.Compare(b.At)
+	})
+	return medians
+}
+
+// renderPriceChart renders a scatter chart of values over time, with a line through the
+// daily medians, as a PNG image.
+//
+// Parameters:
+//
+//	points ([]chartPoint): The values, in any order.
+//	from (time.Time): The start of the time axis.
+//	to (time.Time): The end of the time axis.
+//
+// Returns:
+//
+//	[]byte: The PNG image.
+//	error: An error if the image cannot be encoded, otherwise nil.
+func renderPriceChart(points []chartPoint, from time.Time, to time.Time) ([]byte, error) {
+	c := chartCanvas{img: image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))}
+	c.fillRect(0, 0, chartWidth, chartHeight, chartColors.Background)
+
+	left, top := chartMargin.Left, chartMargin.Top
+	right, bottom := chartWidth-chartMargin.Right, chartHeight-chartMargin.Bottom
+
+	low := slices.MinFunc(points, func(a, b chartPoint) int { return cmp.Compare(a.Value, b.Value) }).Value
+	high := slices.MaxFunc(points, func(a, b chartPoint) int { return cmp.Compare(a.Value, b.Value) }).Value
+	if high == low {
+		low, high = low*0.9, high*1.1+1
+	}
+	step := niceStep((high - low) / 5)
+	low, high = math.Floor(low/step)*step, math.Ceil(high/step)*step
+
+	x := func(t time.Time) int {
+		return left + int(float64(right-left)*t.Sub(from).Seconds()/to.Sub(from).Seconds())
+	}
+	y := func(value float64) int {
+		return bottom - int(float64(bottom-top)*(value-low)/(high-low))
+	}
+
+	// horizontal grid lines with the values
+	for value := low; value <= high+step/2; value += step {
+		c.fillRect(left, y(value), right, y(value)+1, chartColors.Grid)
+		label := compactAmount(value)
+		c.drawText(left-12-textWidth(label, 2), y(value)-7, label, 2, chartColors.Label)
+	}
+	// vertical grid lines with the dates
+	days := int(math.Ceil(to.Sub(from).Hours() / 24))
+	dayStep := max((days+6)/7, 1)
+	start := from.In(tehran)
+	for day := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, tehran); day.Before(to); day = day.AddDate(0, 0, dayStep) {
+		c.fillRect(x(day), top, x(day)+1, bottom, chartColors.Grid)
+		label := day.Format("01-02")
+		c.drawText(x(day)-textWidth(label, 2)/2, bottom+14, label, 2, chartColors.Label)
+	}
+	c.fillRect(left, top, left+2, bottom, chartColors.Axis)
+	c.fillRect(left, bottom-1, right, bottom+1, chartColors.Axis)
+
+	for _, point := range points {
+		c.fillCircle(x(point.At), y(point.Value), 4, chartColors.Point)
+	}
+	medians := dailyMedians(points)
+	for i, point := range medians {
+		if i > 0 {
+			previous := medians[i-1]
+			c.drawLine(x(previous.At), y(previous.Value), x(point.At), y(point.Value), 3, chartColors.Median)
+		}
+		c.fillCircle(x(point.At), y(point.Value), 5, chartColors.Median)
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, c.img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func handlerChart(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alerts, err := listAlerts(botName(b), chatId)
+	if err != nil {
+		sugar.Errorw("Failed to list alerts", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "chart.error"),
+		})
+		return
+	}
+
+	args := strings.Fields(commandArgs(update.Message.Text))
+	days := chartDefaultDays
+	if len(args) == 2 {
+		days, err = strconv.Atoi(divar.NormalizeDigits(args[1]))
+	}
+	var alert Alert
+	ok := false
+	if len(args) == 1 || len(args) == 2 {
+		alert, ok = alertByNumber(alerts, args[0])
+	}
+	if !ok || err != nil || days < 1 || days > chartMaxDays {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "chart.usage", chartMaxDays),
+		})
+		return
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -days)
+	records, err := alertPriceRecords(alert.Id, from)
+	if err != nil {
+		sugar.Errorw("Failed to read price records", "error", err, "alert", alert.Title)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "chart.error"),
+		})
+		return
+	}
+	var points []chartPoint
+	var values []float64
+	for _, record := range records {
+		if value, ok := record.PricePerMeter(); ok {
+			points = append(points, chartPoint{At: time.Unix(record.SeenAt, 0), Value: value})
+			values = append(values, value)
+		}
+	}
+	if len(points) < 2 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "chart.empty", alert.Title),
+		})
+		return
+	}
+
+	chart, err := renderPriceChart(points, from, now)
+	if err != nil {
+		sugar.Errorw("Failed to render chart", "error", err, "alert", alert.Title)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "chart.error"),
+		})
+		return
+	}
+	_, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:  chatId,
+		Photo:   &models.InputFileUpload{Filename: "chart.png", Data: bytes.NewReader(chart)},
+		Caption: tr(lang, "chart.caption", alert.Title, days, len(points), formatAmount(summarizeAmounts(values).Median)),
+	})
+	if err != nil {
+		sugar.Errorw("Failed to send chart", "error", err, "alert", alert.Title)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompactAmount(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "0"},
+		{950, "950"},
+		{1000, "1k"},
+		{85_500_000, "85.5M"},
+		{1_240_000_000, "1.2B"},
+		{-2_000_000, "-2M"},
+	}
+	for _, test := range tests {
+		if got := compactAmount(test.amount); got != test.want {
+			t.Errorf("compactAmount(%v) = %q, want %q", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		step float64
+		want float64
+	}{
+		{0.03, 0.05},
+		{0.2, 0.2},
+		{0.7, 1},
+		{1, 1},
+		{1.5, 2},
+		{3, 5},
+		{7, 10},
+		{120, 200},
+		{40_000_000, 50_000_000},
+	}
+	for _, test := range tests {
+		if got := niceStep(test.step); got != test.want {
+			t.Errorf("niceStep(%v) = %v, want %v", test.step, got, test.want)
+		}
+	}
+}
+
+func TestDailyMedians(t *testing.T) {
+	// Tehran is 3:30 ahead of UTC, so 21:00 UTC is already the next day there
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []chartPoint{
+		{At: day.Add(8 * time.Hour), Value: 300},
+		{At: day.Add(9 * time.Hour), Value: 100},
+		{At: day.Add(10 * time.Hour), Value: 200},
+		{At: day.Add(11 * time.Hour), Value: 400},
+		{At: day.Add(21 * time.Hour), Value: 1000},
+		{At: day.Add(-4 * time.Hour), Value: 50},
+		{At: day.Add(-3 * time.Hour), Value: 60},
+	}
+	want := []chartPoint{
+		{At: time.Date(2026, 2, 28, 12, 0, 0, 0, tehran), Value: 50},
+		{At: time.Date(2026, 3, 1, 12, 0, 0, 0, tehran), Value: 200},
+		{At: time.Date(2026, 3, 2, 12, 0, 0, 0, tehran), Value: 1000},
+	}
+
+	got := dailyMedians(points)
+	if len(got) != len(want) {
+		t.Fatalf("dailyMedians() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].At.Equal(want[i].At) || got[i].Value != want[i].Value {
+			t.Errorf("day %d = %v %v, want %v %v", i, got[i].At, got[i].Value, want[i].At, want[i].Value)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chatScope identifies a chat of a bot in database keys, e.g. "telegram:123". Chat IDs of
+// Telegram and Bale overlap, so every key of a chat holds the name of its bot too.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	string: The scope of the chat.
+func chatScope(botName string, chatId int64) string {
+	return fmt.Sprintf("%s:%d", botName, chatId)
+}
+
+// parseChatScope reads the chat scope at the start of a key suffix, e.g. "telegram:-100123-abc".
+//
+// Parameters:
+//
+//	text (string): The key without its prefix.
+//
+// Returns:
+//
+//	string: The name of the bot.
+//	int64: The ID of the chat.
+//	string: The rest of the text after the "-" that follows the scope.
+//	bool: False if the text does not start with a chat scope.
+func parseChatScope(text string) (string, int64, string, bool) {
+	name, rest, ok := strings.Cut(text, ":")
+	if !ok || name == "" {
+		return "", 0, "", false
+	}
+	// chat IDs of groups are negative, so the "-" that ends the ID is looked for after its sign
+	unsigned := strings.TrimPrefix(rest, "-")
+	id, suffix, _ := strings.Cut(unsigned, "-")
+	chatId, err := strconv.ParseInt(rest[:len(rest)-len(unsigned)]+id, 10, 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+	return name, chatId, suffix, true
+}
+
+// chatKey builds the database key under which the settings of a chat are stored.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	[]byte: The database key of the chat.
+func chatKey(botName string, chatId int64) []byte {
+	return []byte("chat-" + chatScope(botName, chatId))
+}
+
+// getChat reads the settings of a chat within the given transaction.
+// A chat without stored settings gets the default settings.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	Chat: The settings of the chat.
+//	error: An error if the settings cannot be read, otherwise nil.
+func getChat(txn *badger.Txn, botName string, chatId int64) (Chat, error) {
+	chat := Chat{Id: chatId, Bot: botName}
+	item, err := txn.Get(chatKey(botName, chatId))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return chat, nil
+	}
+	if err != nil {
+		return Chat{}, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &chat)
+	})
+	if err != nil {
+		return Chat{}, err
+	}
+	return chat, nil
+}
+
+// updateChat loads the settings of a chat, applies the given change and saves them back.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	change (func(*Chat)): The function that modifies the settings.
+//
+// Returns:
+//
+//	Chat: The updated settings.
+//	error: An error if the operation fails, otherwise nil.
+func updateChat(botName string, chatId int64, change func(*Chat)) (Chat, error) {
+	var chat Chat
+	err := db.Update(func(txn *badger.Txn) error {
+		var err error
+		chat, err = getChat(txn, botName, chatId)
+		if err != nil {
+			return err
+		}
+		change(&chat)
+		value, err := json.Marshal(chat)
+		if err != nil {
+			return err
+		}
+		return txn.Set(chatKey(botName, chatId), value)
+	})
+	return chat, err
+}
+
+// commandArgs returns the text that follows the command in a message.
+//
+// Parameters:
+//
+//	text (string): The message text, e.g. "/snooze 2h".
+//
+// Returns:
+//
+//	string: The trimmed arguments, e.g. "2h".
+func commandArgs(text string) string {
+	_, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	return strings.TrimSpace(args)
+}
+
+func handlerSnooze(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	args := commandArgs(update.Message.Text)
+
+	var until int64
+	if args != "off" {
+		duration, err := time.ParseDuration(args)
+		if err != nil || duration <= 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatId,
+				Text:   tr(lang, "snooze.usage"),
+			})
+			return
+		}
+		until = time.Now().Add(duration).Unix()
+	}
+
+	_, err := updateChat(botName(b), chatId, func(chat *Chat) {
+		chat.SnoozeUntil = until
+	})
+	if err != nil {
+		sugar.Errorw("Failed to snooze chat", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "snooze.error"),
+		})
+		return
+	}
+
+	text := tr(lang, "snooze.off")
+	if until != 0 {
+		text = tr(lang, "snooze.on", args)
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   text,
+	})
+}
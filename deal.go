@@ -0,0 +1,149 @@
+package main
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dealWindowDays is the period, in days, of the posts a new post is compared with.
+const dealWindowDays = 30
+
+// dealMinSamples is the number of earlier posts with a price per square meter needed to score a new post.
+const dealMinSamples = 10
+
+// DealScore compares the price per square meter of a post with the earlier posts of its alert.
+type DealScore struct {
+	PerMeter   float64 `json:"perMeter"`   // price per square meter of the post in toman
+	Median     float64 `json:"median"`     // median price per square meter of the earlier posts
+	Difference float64 `json:"difference"` // difference from the median in percent, negative when below it
+	Percentile float64 `json:"percentile"` // percent of the earlier posts that are as cheap or cheaper
+	Samples    int     `json:"samples"`    // number of earlier posts
+	Days       int     `json:"days"`       // period of the earlier posts in days
+}
+
+// alertMarket is the sorted prices per square meter of the posts an alert listed recently.
+type alertMarket []float64
+
+// loadAlertMarket reads the prices per square meter of the posts an alert listed in the last dealWindowDays.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert.
+//
+// Returns:
+//
+//	alertMarket: The prices per square meter, sorted.
+//	error: An error if the records cannot be read, otherwise nil.
+func loadAlertMarket(txn *badger.Txn, alert Alert) (alertMarket, error) {
+	records, err := readPriceRecords(txn, alert.Id, time.Now().AddDate(0, 0, -dealWindowDays))
+	if err != nil {
+		return nil, err
+	}
+	var market alertMarket
+	for _, record := range records {
+		if value, ok := record.PricePerMeter(); ok {
+			market = append(market, value)
+		}
+	}
+	slices.Sort(market)
+	return market, nil
+}
+
+// Score compares the price per square meter of a post with the market.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	*DealScore: The score, or nil if the post has no price per square meter or the market has
+//	  fewer than dealMinSamples posts.
+func (m alertMarket) Score(post divar.PostWidget) *DealScore {
+	perMeter, ok := PriceRecord{PostAttributes: post.Attributes()}.PricePerMeter()
+	if !ok || len(m) < dealMinSamples {
+		return nil
+	}
+	median := summarizeAmounts(m).Median
+	cheaper, _ := slices.BinarySearch(m, math.Nextafter(perMeter, math.Inf(1)))
+	return &DealScore{
+		PerMeter:   perMeter,
+		Median:     median,
+		Difference: (perMeter - median) / median * 100,
+		Percentile: float64(cheaper) / float64(len(m)) * 100,
+		Samples:    len(m),
+		Days:       dealWindowDays,
+	}
+}
+
+// matchesDeal reports whether a post is cheap enough for the deal percentile of its alert.
+// Posts are not judged until the market has enough posts, and posts without a price per
+// square meter do not pass once it has.
+//
+// Parameters:
+//
+//	alert (Alert): The alert that found the post.
+//	market (alertMarket): The recent posts of the alert.
+//	deal (*DealScore): The score of the post, nil if it has none.
+//
+// Returns:
+//
+//	bool: True if the post passes the deal percentile of the alert, otherwise false.
+func matchesDeal(alert Alert, market alertMarket, deal *DealScore) bool {
+	if alert.DealPercentile == 0 || len(market) < dealMinSamples {
+		return true
+	}
+	return deal != nil && deal.Percentile <= alert.DealPercentile
+}
+
+// dealText describes the score of a post.
+//
+// Parameters:
+//
+//	deal (DealScore): The score.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	string: The description, e.g. "12% below the median price per m² of this alert in the last 30 days".
+func dealText(deal DealScore, lang string) string {
+	difference := math.Round(deal.Difference)
+	switch {
+	case difference < 0:
+		return tr(lang, "deal.below", -difference, deal.Days)
+	case difference > 0:
+		return tr(lang, "deal.above", difference, deal.Days)
+	default:
+		return tr(lang, "deal.median", deal.Days)
+	}
+}
+
+// setAlertDealPercentile sets the percentile of the recent posts of an alert below which new posts are sent.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): A percentile between 1 and 100 such as "25", or "off" to send posts at any price.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the value is neither, otherwise nil.
+func setAlertDealPercentile(alert *Alert, value string) error {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "off" {
+		alert.DealPercentile = 0
+		return nil
+	}
+	percentile, err := strconv.ParseFloat(strings.TrimSuffix(divar.NormalizeDigits(value), "%"), 64)
+	if err != nil || !(percentile >= 1 && percentile <= 100) {
+		return &ProcessInputError{Key: "edit.dealPercentile.invalid"}
+	}
+	alert.DealPercentile = percentile
+	return nil
+}
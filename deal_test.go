@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mrmohebi/divar-alert/divar"
+	"math"
+	"testing"
+)
+
+// meterPost builds a post of 100 square meters with the given price per square meter.
+func meterPost(perMeter int64) divar.PostWidget {
+	post := testPost(fmt.Sprint(perMeter), "آپارتمان ۱۰۰ متری")
+	post.Data.MiddleDescriptionText = fmt.Sprintf("%d تومان", perMeter*100)
+	return post
+}
+
+func TestAlertMarketScore(t *testing.T) {
+	// 100, 200, ..., 1000 per square meter, with a median of 550
+	var market alertMarket
+	for i := int64(1); i <= 10; i++ {
+		market = append(market, float64(i*100))
+	}
+
+	tests := []struct {
+		name       string
+		market     alertMarket
+		post       divar.PostWidget
+		percentile float64
+		difference float64
+		scored     bool
+	}{
+		{"cheapest", market, meterPost(50), 0, -90.91, true},
+		// a post at the price of a sample counts that sample as cheaper
+		{"equal to a sample", market, meterPost(500), 50, -9.09, true},
+		{"between samples", market, meterPost(550), 50, 0, true},
+		{"equal to the highest", market, meterPost(1000), 100, 81.82, true},
+		{"above every sample", market, meterPost(2000), 100, 263.64, true},
+		{"one sample short", market[:dealMinSamples-1], meterPost(500), 0, 0, false},
+		{"no area", market, pricedPost("a", "۵۰٬۰۰۰ تومان"), 0, 0, false},
+	}
+	for _, test := range tests {
+		deal := test.market.Score(test.post)
+		if (deal != nil) != test.scored {
+			t.Errorf("%s: Score() = %+v, want scored %v", test.name, deal, test.scored)
+			continue
+		}
+		if deal == nil {
+			continue
+		}
+		if deal.Percentile != test.percentile || math.Abs(deal.Difference-test.difference) > 0.01 {
+			t.Errorf("%s: percentile %v, difference %.2f, want %v, %.2f", test.name, deal.Percentile, deal.Difference, test.percentile, test.difference)
+		}
+		if deal.Median != 550 || deal.Samples != len(test.market) {
+			t.Errorf("%s: median %v of %d samples, want 550 of %d", test.name, deal.Median, deal.Samples, len(test.market))
+		}
+	}
+}
+
+func TestMatchesDeal(t *testing.T) {
+	market := make(alertMarket, dealMinSamples)
+	tests := []struct {
+		name       string
+		percentile float64
+		market     alertMarket
+		deal       *DealScore
+		want       bool
+	}{
+		{"off", 0, market, &DealScore{Percentile: 90}, true},
+		{"too few samples", 25, market[:dealMinSamples-1], nil, true},
+		{"not scored", 25, market, nil, false},
+		{"below", 25, market, &DealScore{Percentile: 10}, true},
+		{"at the percentile", 25, market, &DealScore{Percentile: 25}, true},
+		{"above", 25, market, &DealScore{Percentile: 30}, false},
+	}
+	for _, test := range tests {
+		if got := matchesDeal(Alert{DealPercentile: test.percentile}, test.market, test.deal); got != test.want {
+			t.Errorf("%s: matchesDeal() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSetAlertDealPercentile(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"25", 25, true},
+		{"۲۵%", 25, true},
+		{" 1 ", 1, true},
+		{"100", 100, true},
+		{"OFF", 0, true},
+		{"0", 0, false},
+		{"101", 0, false},
+		{"NaN", 0, false},
+		{"cheap", 0, false},
+	}
+	for _, test := range tests {
+		alert := Alert{DealPercentile: 50}
+		err := setAlertDealPercentile(&alert, test.value)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("setAlertDealPercentile(%q) error = %v, want ok %v", test.value, err, test.ok)
+			continue
+		}
+		if test.ok && alert.DealPercentile != test.want {
+			t.Errorf("setAlertDealPercentile(%q) = %v, want %v", test.value, alert.DealPercentile, test.want)
+		}
+	}
+}
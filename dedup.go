@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"time"
+)
+
+// dedupTTL is how long a chat remembers the posts it got, to skip them for its other alerts.
+const dedupTTL = 30 * 24 * time.Hour
+
+// DedupEntry records that a chat got a post, and which of its alerts matched it.
+//
+// Fields:
+//
+//	Alerts ([]int64): The IDs of the alerts that matched the post.
+//	OutboxKey (string): The key of the chat notification in the outbox, empty if the post was not sent right away.
+//	QueueKey (string): The key of the post in the deferred or digest queue, empty if the post was not queued.
+type DedupEntry struct {
+	Alerts    []int64 `json:"alertIds"`
+	OutboxKey string  `json:"outboxKey"`
+	QueueKey  string  `json:"queueKey,omitempty"`
+}
+
+// dedupKey builds the database key that records that a chat got a post.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the entry.
+func dedupKey(botName string, chatId int64, token string) []byte {
+	return []byte(fmt.Sprintf("dedup-%s-%s", chatScope(botName, chatId), token))
+}
+
+// saveDedupEntry writes a dedup entry, which expires after dedupTTL.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//	entry (DedupEntry): The entry.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func saveDedupEntry(txn *badger.Txn, botName string, chatId int64, token string, entry DedupEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return txn.SetEntry(badger.NewEntry(dedupKey(botName, chatId, token), value).WithTTL(dedupTTL))
+}
+
+// dedupPost checks whether the chat of an alert already got a post from another alert.
+// If so, the alert is added to the alerts listed by the pending notification or the queued post, if any.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	bool: True if the chat already got the post, otherwise false.
+//	error: An error if the operation fails, otherwise nil.
+func dedupPost(txn *badger.Txn, alert Alert, post divar.PostWidget) (bool, error) {
+	item, err := txn.Get(dedupKey(alert.Bot, alert.ChatId, post.Data.Token))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var entry DedupEntry
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &entry)
+	})
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(entry.Alerts, alert.Id) {
+		return true, nil
+	}
+	entry.Alerts = append(entry.Alerts, alert.Id)
+
+	if entry.OutboxKey != "" {
+		outboxItem, err := txn.Get([]byte(entry.OutboxKey))
+		if err == nil {
+			var pending OutboxItem
+			err = outboxItem.Value(func(val []byte) error {
+				return json.Unmarshal(val, &pending)
+			})
+			if err != nil {
+				return true, err
+			}
+			pending.AlsoMatched = append(pending.AlsoMatched, alert.Title)
+			if err := saveOutboxItem(txn, pending); err != nil {
+				return true, err
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return true, err
+		}
+	}
+	if entry.QueueKey != "" {
+		queued, err := txn.Get([]byte(entry.QueueKey))
+		if err == nil {
+			var deferred DeferredPost
+			err = queued.Value(func(val []byte) error {
+				return json.Unmarshal(val, &deferred)
+			})
+			if err != nil {
+				return true, err
+			}
+			deferred.AlsoMatched = append(deferred.AlsoMatched, alert.Title)
+			value, err := json.Marshal(deferred)
+			if err != nil {
+				return true, err
+			}
+			if err := txn.Set([]byte(entry.QueueKey), value); err != nil {
+				return true, err
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return true, err
+		}
+	}
+	return true, saveDedupEntry(txn, alert.Bot, alert.ChatId, post.Data.Token, entry)
+}
+
+// recordDedup records that the chat of an alert got a post.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The post.
+//	recipients ([]Recipient): The recipients the post was queued for.
+//	keys ([]string): The outbox keys of the recipients, in the same order.
+//	queueKey (string): The key of the post in the deferred or digest queue, empty if it was not queued.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func recordDedup(txn *badger.Txn, alert Alert, post divar.PostWidget, recipients []Recipient, keys []string, queueKey string) error {
+	entry := DedupEntry{Alerts: []int64{alert.Id}, QueueKey: queueKey}
+	for i, recipient := range recipients {
+		if recipient.Channel == Channel.Bot && i < len(keys) {
+			entry.OutboxKey = keys[i]
+		}
+	}
+	return saveDedupEntry(txn, alert.Bot, alert.ChatId, post.Data.Token, entry)
+}
+
+func handlerDedup(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	args := commandArgs(update.Message.Text)
+	if args != "on" && args != "off" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "dedup.usage"),
+		})
+		return
+	}
+
+	_, err := updateChat(botName(b), chatId, func(chat *Chat) {
+		chat.Dedup = args == "on"
+	})
+	if err != nil {
+		sugar.Errorw("Failed to change dedup", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "dedup.error"),
+		})
+		return
+	}
+
+	text := tr(lang, "dedup.off")
+	if args == "on" {
+		text = tr(lang, "dedup.on")
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   text,
+	})
+}
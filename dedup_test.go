@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAlertsDedupsQueuedPosts(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	if _, err := updateChat("telegram", 10, func(chat *Chat) { chat.Dedup = true }); err != nil {
+		t.Fatal(err)
+	}
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "daily flats", Link: "flats-link", DigestPeriod: 86400, LastDigestAt: time.Now().Unix()})
+	saveTestAlert(t, Alert{Id: 2, ChatId: 10, Bot: "telegram", Title: "cheap flats", Link: "flats-link"})
+
+	search := func(link string) (divar.SearchRes, error) {
+		return divar.SearchRes{ListWidgets: []divar.PostWidget{testPost("a", "flat")}}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+
+	items, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("outbox holds %d notifications, want the post only in the digest", len(items))
+	}
+	queue, err := readQueue("digest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || !slices.Equal(queue[0].post.AlsoMatched, []string{"cheap flats"}) {
+		t.Fatalf("digest holds %+v, want the post listing the second alert", queue)
+	}
+	if line := queuedPostLine(queue[0], false); !strings.Contains(line, "cheap flats") {
+		t.Errorf("digest line %q does not mention the second alert", line)
+	}
+
+	// the entry holds alert IDs, so a renamed alert is still recognized
+	err = db.Update(func(txn *badger.Txn) error {
+		_, err := dedupPost(txn, Alert{Id: 2, ChatId: 10, Bot: "telegram", Title: "renamed"}, testPost("a", "flat"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue, _ := readQueue("digest-"); len(queue) != 1 || len(queue[0].post.AlsoMatched) != 1 {
+		t.Errorf("digest holds %+v, want the second alert listed once", queue)
+	}
+}
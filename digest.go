@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMessageLength is the maximum length of a text message accepted by the bot API, in UTF-16 code units.
+const maxMessageLength = 4096
+
+// maxCaptionLength is the maximum length of a media caption accepted by the bot API, in UTF-16 code units.
+const maxCaptionLength = 1024
+
+// maxMediaGroupSize is the maximum number of items in a media group accepted by the bot API.
+const maxMediaGroupSize = 10
+
+// DigestStyle holds the supported ways of sending a digest.
+//
+// Fields:
+//
+//	List (string): A text message listing the posts.
+//	Album (string): A media group of the post images with the list as caption.
+var DigestStyle = struct {
+	List  string
+	Album string
+}{
+	List:  "list",
+	Album: "album",
+}
+
+// parseDelivery parses the delivery mode entered for an alert, e.g. "0", "60" or "60 album".
+//
+// Parameters:
+//
+//	input (string): The number of minutes per digest, optionally followed by the digest style.
+//
+// Returns:
+//
+//	int: The digest period in seconds, 0 for immediate delivery.
+//	string: The digest style.
+//	error: An error if the input is invalid, otherwise nil.
+func parseDelivery(input string) (int, string, error) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, "", fmt.Errorf("invalid delivery mode %q", input)
+	}
+	minutes, err := strconv.Atoi(fields[0])
+	if err != nil || minutes < 0 {
+		return 0, "", fmt.Errorf("invalid digest period %q", fields[0])
+	}
+	style := DigestStyle.List
+	if len(fields) == 2 {
+		switch strings.ToLower(fields[1]) {
+		case DigestStyle.List:
+		case DigestStyle.Album:
+			style = DigestStyle.Album
+		default:
+			return 0, "", fmt.Errorf("invalid digest style %q", fields[1])
+		}
+	}
+	return minutes * 60, style, nil
+}
+
+// queuedPost is a post waiting in a delivery queue together with its database key.
+type queuedPost struct {
+	key  []byte
+	post DeferredPost
+}
+
+// readQueue reads all queued posts stored under the given key prefix, oldest first.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+//
+// Returns:
+//
+//	[]queuedPost: The queued posts.
+//	error: An error if the queue cannot be read, otherwise nil.
+func readQueue(prefix string) ([]queuedPost, error) {
+	var queue []queuedPost
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			var deferred DeferredPost
+			err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &deferred)
+			})
+			if err != nil {
+				sugar.Errorw("Failed to unmarshal queued post", "error", err, "key", string(item.Key()))
+				continue
+			}
+			queue = append(queue, queuedPost{key: item.KeyCopy(nil), post: deferred})
+		}
+		return nil
+	})
+	return queue, err
+}
+
+// QueueRetry is the delivery state of a queue whose last delivery failed.
+//
+// Fields:
+//
+//	Attempts (int): The number of failed deliveries.
+//	NextAttemptAt (int64): The timestamp before which no delivery is attempted.
+//	LastError (string): The error of the last failed delivery.
+type QueueRetry struct {
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt int64  `json:"nextAttemptAt"`
+	LastError     string `json:"lastError"`
+}
+
+// queueRetryKey builds the database key of the delivery state of a queue.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+//
+// Returns:
+//
+//	[]byte: The database key of the delivery state.
+func queueRetryKey(prefix string) []byte {
+	return []byte("retry-" + prefix)
+}
+
+// getQueueRetry reads the delivery state of a queue.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+//
+// Returns:
+//
+//	QueueRetry: The delivery state, empty if the last delivery did not fail.
+//	error: An error if the state cannot be read, otherwise nil.
+func getQueueRetry(prefix string) (QueueRetry, error) {
+	var retry QueueRetry
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(queueRetryKey(prefix))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &retry)
+		})
+	})
+	return retry, err
+}
+
+// queueDue reports whether a queue may be delivered now, i.e. it is not waiting after a failed delivery.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+//
+// Returns:
+//
+//	bool: True if the queue may be delivered, otherwise false.
+func queueDue(prefix string) bool {
+	retry, err := getQueueRetry(prefix)
+	if err != nil {
+		sugar.Errorw("Failed to read queue delivery state", "error", err, "queue", prefix)
+	}
+	return retry.NextAttemptAt <= time.Now().Unix()
+}
+
+// queueDelivered forgets the failed deliveries of a queue once it was delivered.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+func queueDelivered(prefix string) {
+	err := db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(queueRetryKey(prefix))
+	})
+	if err != nil {
+		sugar.Errorw("Failed to reset queue delivery state", "error", err, "queue", prefix)
+	}
+}
+
+// queueFailed reschedules the delivery of a queue with the backoff of the outbox, or after the
+// delay requested by the bot API. After maxOutboxAttempts failures the remaining posts are dropped.
+//
+// Parameters:
+//
+//	prefix (string): The key prefix of the queue.
+//	queue ([]queuedPost): The posts of the queue.
+//	sendErr (error): The error of the failed delivery.
+func queueFailed(prefix string, queue []queuedPost, sendErr error) {
+	retry, err := getQueueRetry(prefix)
+	if err != nil {
+		sugar.Errorw("Failed to read queue delivery state", "error", err, "queue", prefix)
+	}
+	retry.LastError = sendErr.Error()
+	if delay := retryAfter(sendErr); delay > 0 {
+		// a requested delay is not a failure of the queue itself
+		sugar.Warnw("Bot API asked to retry queued posts later", "retryAfter", delay, "queue", prefix)
+		retry.NextAttemptAt = time.Now().Add(delay).Unix()
+	} else {
+		retry.Attempts++
+		if retry.Attempts >= maxOutboxAttempts {
+			sugar.Errorw("Dropping queued posts after too many failed attempts", "error", sendErr, "queue", prefix)
+			if err := removeQueued(queue); err != nil {
+				sugar.Errorw("Failed to remove queued posts", "error", err, "queue", prefix)
+			}
+			queueDelivered(prefix)
+			return
+		}
+		sugar.Warnw("Failed to send queued posts, will retry", "error", sendErr, "queue", prefix, "attempts", retry.Attempts)
+		retry.NextAttemptAt = time.Now().Add(outboxBackoff(retry.Attempts)).Unix()
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		value, err := json.Marshal(retry)
+		if err != nil {
+			return err
+		}
+		return txn.Set(queueRetryKey(prefix), value)
+	})
+	if err != nil {
+		sugar.Errorw("Failed to save queue delivery state", "error", err, "queue", prefix)
+	}
+}
+
+// removeQueued deletes delivered posts from their queue.
+//
+// Parameters:
+//
+//	queue ([]queuedPost): The delivered posts.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func removeQueued(queue []queuedPost) error {
+	return db.Update(func(txn *badger.Txn) error {
+		for _, q := range queue {
+			if err := txn.Delete(q.key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// postSummary builds the compact description of a post used in lists, e.g. its price.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	string: The non-empty description fields of the post joined together.
+func postSummary(post divar.PostWidget) string {
+	var parts []string
+	for _, text := range []string{post.Data.TopDescriptionText, post.Data.MiddleDescriptionText, post.Data.BottomDescriptionText} {
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// queuedPostLine builds the entry of a queued post in a list message. The other
+// alerts of the chat that matched the post and the note of the post are always mentioned.
+//
+// Parameters:
+//
+//	q (queuedPost): The queued post.
+//	withAlert (bool): Whether the title of the alert should be mentioned.
+//
+// Returns:
+//
+//	string: The list entry.
+func queuedPostLine(q queuedPost, withAlert bool) string {
+	line := "- " + q.post.Post.Data.Title
+	var alerts []string
+	if withAlert && q.post.AlertTitle != "" {
+		alerts = append(alerts, q.post.AlertTitle)
+	}
+	alerts = append(alerts, q.post.AlsoMatched...)
+	if len(alerts) > 0 {
+		line += " (" + strings.Join(alerts, ", ") + ")"
+	}
+	line += "\n"
+	if q.post.Note != "" {
+		line += q.post.Note + "\n"
+	}
+	if summary := postSummary(q.post.Post); summary != "" {
+		line += summary + "\n"
+	}
+	return line + postURL(q.post.Post.Data.Token) + "\n\n"
+}
+
+// sendQueuedList sends queued posts as text messages, splitting them over several
+// messages when needed. Each post is removed from its queue once the message
+// containing it has been sent.
+//
+// Parameters:
+//
+//	instance (*botInstance): The bot that sends the messages.
+//	chatId (int64): The ID of the chat.
+//	header (string): The text that starts every message.
+//	queue ([]queuedPost): The posts to be sent.
+//	withAlert (bool): Whether the title of the alert should be mentioned for each post.
+//
+// Returns:
+//
+//	error: An error if a message could not be sent, nil if all posts were delivered.
+func sendQueuedList(instance *botInstance, chatId int64, header string, queue []queuedPost, withAlert bool) error {
+	text := header
+	var sent []queuedPost
+	flush := func() error {
+		if err := instance.Limiter.Wait(context.Background(), chatId); err != nil {
+			return err
+		}
+		_, err := instance.Bot.SendMessage(context.Background(), &bot.SendMessageParams{
+			ChatID:             chatId,
+			Text:               text,
+			LinkPreviewOptions: &models.LinkPreviewOptions{IsDisabled: bot.True()},
+		})
+		if err != nil {
+			return observeSend(instance, err)
+		}
+		if err := removeQueued(sent); err != nil {
+			sugar.Errorw("Failed to remove delivered posts from queue", "error", err, "chat", chatId)
+		}
+		text = header
+		sent = nil
+		return nil
+	}
+
+	for _, q := range queue {
+		line := queuedPostLine(q, withAlert)
+		if len(sent) > 0 && textLength(text+line) > maxMessageLength {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		text += line
+		sent = append(sent, q)
+	}
+	if len(sent) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// nextAlbum selects the posts of the next album: the first posts whose lines fit in its
+// caption, up to the size of a media group. The other posts wait for a later album.
+//
+// Parameters:
+//
+//	header (string): The text that starts the caption.
+//	queue ([]queuedPost): The posts with an image still to be sent, at least one.
+//
+// Returns:
+//
+//	[]queuedPost: The posts of the album, at least one.
+//	string: The caption of the album.
+func nextAlbum(header string, queue []queuedPost) ([]queuedPost, string) {
+	caption := header
+	var group []queuedPost
+	for _, q := range queue[:min(maxMediaGroupSize, len(queue))] {
+		line := queuedPostLine(q, false)
+		if len(group) > 0 && textLength(caption+line) > maxCaptionLength {
+			break
+		}
+		caption += line
+		group = append(group, q)
+	}
+	// a single post whose line is too long is still sent, with its line cut
+	return group, truncateText(caption, maxCaptionLength)
+}
+
+// sendQueuedAlbum sends queued posts as media groups of their images, with the list
+// of the posts as caption of the first image. Posts without an image are sent as a list.
+//
+// Parameters:
+//
+//	instance (*botInstance): The bot that sends the messages.
+//	chatId (int64): The ID of the chat.
+//	header (string): The text that starts every caption.
+//	queue ([]queuedPost): The posts to be sent.
+//
+// Returns:
+//
+//	error: An error if a message could not be sent, nil if all posts were delivered.
+func sendQueuedAlbum(instance *botInstance, chatId int64, header string, queue []queuedPost) error {
+	var withImage, withoutImage []queuedPost
+	for _, q := range queue {
+		if q.post.Post.Data.ImageURL == "" {
+			withoutImage = append(withoutImage, q)
+		} else {
+			withImage = append(withImage, q)
+		}
+	}
+
+	for len(withImage) > 0 {
+		group, caption := nextAlbum(header, withImage)
+		withImage = withImage[len(group):]
+
+		if err := instance.Limiter.Wait(context.Background(), chatId); err != nil {
+			return err
+		}
+		var err error
+		if len(group) == 1 {
+			_, err = instance.Bot.SendPhoto(context.Background(), &bot.SendPhotoParams{
+				ChatID:  chatId,
+				Photo:   &models.InputFileString{Data: group[0].post.Post.Data.ImageURL},
+				Caption: caption,
+			})
+		} else {
+			var media []models.InputMedia
+			for i, q := range group {
+				photo := &models.InputMediaPhoto{Media: q.post.Post.Data.ImageURL}
+				if i == 0 {
+					photo.Caption = caption
+				}
+				media = append(media, photo)
+			}
+			_, err = instance.Bot.SendMediaGroup(context.Background(), &bot.SendMediaGroupParams{
+				ChatID: chatId,
+				Media:  media,
+			})
+		}
+		if err != nil {
+			return observeSend(instance, err)
+		}
+		if err := removeQueued(group); err != nil {
+			sugar.Errorw("Failed to remove delivered posts from queue", "error", err, "chat", chatId)
+		}
+	}
+
+	if len(withoutImage) > 0 {
+		return sendQueuedList(instance, chatId, header, withoutImage, false)
+	}
+	return nil
+}
+
+// queueDigestPost adds a new post to the digest of an alert.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The new post.
+//
+// Returns:
+//
+//	string: The key of the queued post.
+//	error: An error if the operation fails, otherwise nil.
+func queueDigestPost(txn *badger.Txn, alert Alert, post divar.PostWidget) (string, error) {
+	value, err := json.Marshal(DeferredPost{
+		Bot:        alert.Bot,
+		AlertId:    alert.Id,
+		AlertTitle: alert.Title,
+		Post:       post,
+	})
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("digest-%s-%d-%d", chatScope(alert.Bot, alert.ChatId), alert.Id, time.Now().UnixNano())
+	return key, txn.Set([]byte(key), value)
+}
+
+// queueDigestEmail adds an email with the digest posts not emailed yet to the outbox,
+// and marks those posts as emailed so a retry of the chat digest does not email them again.
+//
+// Parameters:
+//
+//	alert (Alert): The digest alert.
+//	queue ([]queuedPost): The posts of the digest.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func queueDigestEmail(alert Alert, queue []queuedPost) error {
+	var posts []divar.PostWidget
+	var pending []queuedPost
+	for _, q := range queue {
+		if !q.post.Emailed {
+			posts = append(posts, q.post.Post)
+			pending = append(pending, q)
+		}
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+
+	return db.Update(func(txn *badger.Txn) error {
+		now := time.Now()
+		item := OutboxItem{
+			Key:           fmt.Sprintf("outbox-%d-digest-%d", now.UnixNano(), alert.Id),
+			Recipient:     Recipient{Channel: Channel.Email, Address: alert.Email},
+			Alert:         alert,
+			Digest:        posts,
+			CreatedAt:     now.Unix(),
+			NextAttemptAt: now.Unix(),
+		}
+		if err := saveOutboxItem(txn, item); err != nil {
+			return err
+		}
+		for _, q := range pending {
+			q.post.Emailed = true
+			value, err := json.Marshal(q.post)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(q.key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deliverDigests sends the accumulated posts of every digest alert whose period is over.
+// Digests that become due during the quiet hours of their chat wait until the quiet hours end.
+//
+// Parameters:
+//
+//	notifiers (map[string]Notifier): The configured notifiers, to know whether digests can be emailed.
+func deliverDigests(notifiers map[string]Notifier) {
+	var alerts []Alert
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("alert-")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var alert Alert
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &alert)
+			})
+			if err != nil {
+				sugar.Errorw("Failed to unmarshal alert", "error", err)
+				continue
+			}
+			if alert.DigestPeriod > 0 && alert.LastDigestAt+int64(alert.DigestPeriod) <= time.Now().Unix() {
+				alerts = append(alerts, alert)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		sugar.Errorw("Failed to read digest alerts", "error", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		var chat Chat
+		err := db.View(func(txn *badger.Txn) error {
+			var err error
+			chat, err = getChat(txn, alert.Bot, alert.ChatId)
+			return err
+		})
+		if err != nil {
+			sugar.Errorw("Failed to read chat settings", "error", err, "chat", alert.ChatId)
+			continue
+		}
+		prefix := fmt.Sprintf("digest-%s-%d-", chatScope(alert.Bot, alert.ChatId), alert.Id)
+		if inQuietHours(chat, time.Now()) || !queueDue(prefix) {
+			continue
+		}
+
+		queue, err := readQueue(prefix)
+		if err != nil {
+			sugar.Errorw("Failed to read digest", "error", err, "alert", alert.Title)
+			continue
+		}
+
+		if _, ok := notifiers[Channel.Email]; ok && alert.Email != "" {
+			if err := queueDigestEmail(alert, queue); err != nil {
+				sugar.Errorw("Failed to queue digest email", "error", err, "alert", alert.Title)
+				continue
+			}
+		}
+
+		if len(queue) > 0 {
+			instance, ok := findBot(alert.Bot)
+			if !ok {
+				sugar.Errorw("Dropping digest of a bot that is not configured", "bot", alert.Bot, "alert", alert.Title)
+				if err := removeQueued(queue); err != nil {
+					sugar.Errorw("Failed to remove digest posts", "error", err, "alert", alert.Title)
+				}
+				continue
+			}
+			header := tr(chat.Lang, "digest.header", len(queue), alert.Title)
+			if alert.DigestStyle == DigestStyle.Album {
+				err = sendQueuedAlbum(instance, alert.ChatId, header, queue)
+			} else {
+				err = sendQueuedList(instance, alert.ChatId, header, queue, false)
+			}
+			if err != nil {
+				queueFailed(prefix, queue, err)
+				continue
+			}
+			queueDelivered(prefix)
+		}
+
+		_, err = updateAlert(alert.Bot, alert.ChatId, alert.Id, func(alert *Alert) error {
+			alert.LastDigestAt = time.Now().Unix()
+			return nil
+		})
+		if err != nil {
+			sugar.Errorw("Failed to update last digest time", "error", err, "alert", alert.Title)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queueTestPosts stores deferred posts of a chat and returns its queue.
+func queueTestPosts(t *testing.T, alert Alert, tokens ...string) []queuedPost {
+	t.Helper()
+	err := db.Update(func(txn *badger.Txn) error {
+		for _, token := range tokens {
+			if _, err := deferPost(txn, alert, testPost(token, "flat "+token)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, err := readQueue("deferred-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
+
+func TestQueueFailedBacksOff(t *testing.T) {
+	openTestDB(t)
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats"}
+	prefix := "deferred-" + chatScope(alert.Bot, alert.ChatId) + "-"
+	queue := queueTestPosts(t, alert, "a", "b")
+
+	if !queueDue(prefix) {
+		t.Fatal("a queue that never failed is not due")
+	}
+
+	queueFailed(prefix, queue, errors.New("bad request"))
+	retry, err := getQueueRetry(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Attempts != 1 || retry.LastError != "bad request" || queueDue(prefix) {
+		t.Errorf("after a failure the state is %+v, due %v, want one attempt and a wait", retry, queueDue(prefix))
+	}
+	if wait := time.Until(time.Unix(retry.NextAttemptAt, 0)); wait > outboxBackoff(1) {
+		t.Errorf("first retry waits %v, want at most %v", wait, outboxBackoff(1))
+	}
+
+	queueFailed(prefix, queue, &RetryLaterError{After: time.Minute, Err: errors.New("too many requests")})
+	if retry, _ := getQueueRetry(prefix); retry.Attempts != 1 {
+		t.Errorf("a requested delay counted as attempt %d", retry.Attempts)
+	}
+
+	queueDelivered(prefix)
+	if !queueDue(prefix) {
+		t.Error("a delivered queue is still waiting")
+	}
+}
+
+func TestQueueFailedDropsAfterMaxAttempts(t *testing.T) {
+	openTestDB(t)
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats"}
+	prefix := "deferred-" + chatScope(alert.Bot, alert.ChatId) + "-"
+	queue := queueTestPosts(t, alert, "a", "b")
+
+	err := db.Update(func(txn *badger.Txn) error {
+		value, _ := json.Marshal(QueueRetry{Attempts: maxOutboxAttempts - 1})
+		return txn.Set(queueRetryKey(prefix), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueFailed(prefix, queue, errors.New("chat not found"))
+
+	remaining, err := readQueue(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("%d posts are still queued, want them dropped", len(remaining))
+	}
+	if retry, _ := getQueueRetry(prefix); retry.Attempts != 0 {
+		t.Errorf("the state of a dropped queue is kept: %+v", retry)
+	}
+}
+
+func TestNextAlbumKeepsPostsThatDoNotFit(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	var queue []queuedPost
+	for _, token := range []string{"a", "b", "c", "d", "e"} {
+		post := testPost(token, "flat "+token)
+		post.Data.ImageURL = "https://example.com/" + token + ".jpg"
+		post.Data.TopDescriptionText = long
+		queue = append(queue, queuedPost{key: []byte(token), post: DeferredPost{Post: post}})
+	}
+
+	group, caption := nextAlbum("header\n", queue)
+	if len(group) == 0 || len(group) == len(queue) {
+		t.Fatalf("album holds %d of %d posts, want only those that fit", len(group), len(queue))
+	}
+	if textLength(caption) > maxCaptionLength {
+		t.Errorf("caption is %d units, want at most %d", textLength(caption), maxCaptionLength)
+	}
+	for _, q := range group {
+		if !strings.Contains(caption, postURL(q.post.Post.Data.Token)) {
+			t.Errorf("caption lacks the post %s of the album", q.post.Post.Data.Token)
+		}
+	}
+	if strings.Contains(caption, postURL(queue[len(group)].post.Post.Data.Token)) {
+		t.Error("caption mentions a post left for the next album")
+	}
+
+	// a post whose line alone is too long is sent on its own with its line cut
+	queue[0].post.Post.Data.TopDescriptionText = strings.Repeat("x", 2*maxCaptionLength)
+	group, caption = nextAlbum("header\n", queue)
+	if len(group) != 1 || textLength(caption) > maxCaptionLength {
+		t.Errorf("album holds %d posts with a %d unit caption, want the long post alone", len(group), textLength(caption))
+	}
+}
+
+func TestDeliverDigestsEmailsOnlyWithEmailNotifier(t *testing.T) {
+	openTestDB(t)
+	// the bot is not configured, so the chat digest is dropped once the email is queued
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", DigestPeriod: 3600, Email: "user@example.com"}
+	for _, notifiers := range []map[string]Notifier{
+		{Channel.Bot: &recordingNotifier{}},
+		{Channel.Bot: &recordingNotifier{}, Channel.Email: &recordingNotifier{}},
+	} {
+		saveTestAlert(t, alert)
+		err := db.Update(func(txn *badger.Txn) error {
+			_, err := queueDigestPost(txn, alert, testPost("a", "flat"))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deliverDigests(notifiers)
+	}
+
+	outbox, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].Recipient.Channel != Channel.Email {
+		t.Errorf("outbox = %+v, want the email of the digest delivered with an email notifier", outbox)
+	}
+}
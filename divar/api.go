@@ -1,8 +1,12 @@
 package divar
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os/exec"
 	"strings"
 	"time"
@@ -10,6 +14,89 @@ import (
 
 type APIPath struct {
 	SearchList string
+	PostDetail string
+}
+
+// APIBaseURL is the base URL of the Divar API.
+const APIBaseURL = "https://api.divar.ir"
+
+// PostWidget is a single post entry of the search result list.
+type PostWidget struct {
+	WidgetType string `json:"widget_type"`
+	Data       struct {
+		Type   string `json:"@type"`
+		Title  string `json:"title"`
+		Action struct {
+			Type    string `json:"type"`
+			Payload struct {
+				Type    string `json:"@type"`
+				Token   string `json:"token"`
+				WebInfo struct {
+					Title           string `json:"title"`
+					CityPersian     string `json:"city_persian"`
+					DistrictPersian string `json:"district_persian"`
+				} `json:"web_info"`
+			} `json:"payload"`
+		} `json:"action"`
+		ImageURL              string `json:"image_url"`
+		BottomDescriptionText string `json:"bottom_description_text"`
+		RedText               string `json:"red_text"`
+		MiddleDescriptionText string `json:"middle_description_text"`
+		HasDivider            bool   `json:"has_divider"`
+		ImageCount            int    `json:"image_count"`
+		TopDescriptionText    string `json:"top_description_text"`
+		ImageTopLeftTag       struct {
+			Text string `json:"text"`
+			Icon struct {
+				ImageURLDark  string `json:"image_url_dark"`
+				ImageURLLight string `json:"image_url_light"`
+				IconName      string `json:"icon_name"`
+				IconColor     string `json:"icon_color"`
+			} `json:"icon"`
+		} `json:"image_top_left_tag"`
+		Token                    string `json:"token"`
+		ShouldIndicateSeenStatus bool   `json:"should_indicate_seen_status"`
+	} `json:"data"`
+	ActionLog struct {
+		ServerSideInfo struct {
+			Info struct {
+				Type       string `json:"@type"`
+				PostToken  string `json:"post_token"`
+				Index      int    `json:"index"`
+				PostType   string `json:"post_type"`
+				ListType   string `json:"list_type"`
+				SourcePage string `json:"source_page"`
+				ExtraData  struct {
+					Type string `json:"@type"`
+					Jli  struct {
+						Sort struct {
+							Value string `json:"value"`
+						} `json:"sort"`
+						Cities []string `json:"cities"`
+						Price  struct {
+							Max int `json:"max"`
+							Min int `json:"min"`
+						} `json:"price"`
+						Category struct {
+							Value string `json:"value"`
+						} `json:"category"`
+					} `json:"jli"`
+					SearchUID  string `json:"search_uid"`
+					SearchData struct {
+						FormDataJSON      string   `json:"form_data_json"`
+						ServerPayloadJSON string   `json:"server_payload_json"`
+						Cities            []string `json:"cities"`
+						QueryInputType    string   `json:"query_input_type"`
+					} `json:"search_data"`
+				} `json:"extra_data"`
+				SortDate time.Time `json:"sort_date"`
+			} `json:"info"`
+			ItemType struct {
+				Type string `json:"type"`
+			} `json:"item_type"`
+		} `json:"server_side_info"`
+		Enabled bool `json:"enabled"`
+	} `json:"action_log"`
 }
 
 type SearchRes struct {
@@ -59,83 +146,8 @@ type SearchRes struct {
 			} `json:"items"`
 		} `json:"data"`
 	} `json:"list_top_widgets"`
-	ListWidgets []struct {
-		WidgetType string `json:"widget_type"`
-		Data       struct {
-			Type   string `json:"@type"`
-			Title  string `json:"title"`
-			Action struct {
-				Type    string `json:"type"`
-				Payload struct {
-					Type    string `json:"@type"`
-					Token   string `json:"token"`
-					WebInfo struct {
-						Title       string `json:"title"`
-						CityPersian string `json:"city_persian"`
-					} `json:"web_info"`
-				} `json:"payload"`
-			} `json:"action"`
-			ImageURL              string `json:"image_url"`
-			BottomDescriptionText string `json:"bottom_description_text"`
-			RedText               string `json:"red_text"`
-			MiddleDescriptionText string `json:"middle_description_text"`
-			HasDivider            bool   `json:"has_divider"`
-			ImageCount            int    `json:"image_count"`
-			TopDescriptionText    string `json:"top_description_text"`
-			ImageTopLeftTag       struct {
-				Text string `json:"text"`
-				Icon struct {
-					ImageURLDark  string `json:"image_url_dark"`
-					ImageURLLight string `json:"image_url_light"`
-					IconName      string `json:"icon_name"`
-					IconColor     string `json:"icon_color"`
-				} `json:"icon"`
-			} `json:"image_top_left_tag"`
-			Token                    string `json:"token"`
-			ShouldIndicateSeenStatus bool   `json:"should_indicate_seen_status"`
-		} `json:"data"`
-		ActionLog struct {
-			ServerSideInfo struct {
-				Info struct {
-					Type       string `json:"@type"`
-					PostToken  string `json:"post_token"`
-					Index      int    `json:"index"`
-					PostType   string `json:"post_type"`
-					ListType   string `json:"list_type"`
-					SourcePage string `json:"source_page"`
-					ExtraData  struct {
-						Type string `json:"@type"`
-						Jli  struct {
-							Sort struct {
-								Value string `json:"value"`
-							} `json:"sort"`
-							Cities []string `json:"cities"`
-							Price  struct {
-								Max int `json:"max"`
-								Min int `json:"min"`
-							} `json:"price"`
-							Category struct {
-								Value string `json:"value"`
-							} `json:"category"`
-						} `json:"jli"`
-						SearchUID  string `json:"search_uid"`
-						SearchData struct {
-							FormDataJSON      string   `json:"form_data_json"`
-							ServerPayloadJSON string   `json:"server_payload_json"`
-							Cities            []string `json:"cities"`
-							QueryInputType    string   `json:"query_input_type"`
-						} `json:"search_data"`
-					} `json:"extra_data"`
-					SortDate time.Time `json:"sort_date"`
-				} `json:"info"`
-				ItemType struct {
-					Type string `json:"type"`
-				} `json:"item_type"`
-			} `json:"server_side_info"`
-			Enabled bool `json:"enabled"`
-		} `json:"action_log"`
-	} `json:"list_widgets"`
-	SearchData struct {
+	ListWidgets []PostWidget `json:"list_widgets"`
+	SearchData  struct {
 		FormData struct {
 			Data struct {
 				Category struct {
@@ -276,8 +288,114 @@ type SearchRes struct {
 	} `json:"seo_details"`
 }
 
+// PostDetail is the page of a single post, made of sections of widgets.
+type PostDetail struct {
+	Sections []struct {
+		SectionName string         `json:"section_name"`
+		Widgets     []DetailWidget `json:"widgets"`
+	} `json:"sections"`
+}
+
+// DetailWidget is a widget of the post page. Only the fields used by the bot are decoded.
+type DetailWidget struct {
+	WidgetType string `json:"widget_type"`
+	Data       struct {
+		Type  string `json:"@type"`
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Items []struct {
+			ImageURL string `json:"image_url"`
+			Image    struct {
+				URL string `json:"url"`
+			} `json:"image"`
+		} `json:"items"`
+	} `json:"data"`
+}
+
+// ImageURLs returns the URLs of the images in the image carousel of the post.
+func (d PostDetail) ImageURLs() []string {
+	var urls []string
+	for _, section := range d.Sections {
+		for _, widget := range section.Widgets {
+			if widget.WidgetType != "IMAGE_CAROUSEL" {
+				continue
+			}
+			for _, item := range widget.Data.Items {
+				if item.Image.URL != "" {
+					urls = append(urls, item.Image.URL)
+				} else if item.ImageURL != "" {
+					urls = append(urls, item.ImageURL)
+				}
+			}
+		}
+	}
+	return urls
+}
+
+// Price returns the price text shown on the page of the post, such as "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان".
+// The deposit and the rent of a rental are shown on separate rows, and are joined with
+// their labels, such as "ودیعه: ۲۰۰ میلیون تومان، اجاره: ۱۰ میلیون تومان".
+func (d PostDetail) Price() string {
+	rows := map[string]string{}
+	for _, section := range d.Sections {
+		for _, widget := range section.Widgets {
+			title, value := strings.TrimSpace(widget.Data.Title), strings.TrimSpace(widget.Data.Value)
+			if _, ok := rows[title]; !ok && value != "" {
+				rows[title] = value
+			}
+		}
+	}
+	for _, title := range []string{"قیمت کل", "قیمت"} {
+		if value, ok := rows[title]; ok {
+			return value
+		}
+	}
+	var parts []string
+	if value, ok := rows["ودیعه"]; ok {
+		parts = append(parts, "ودیعه: "+value)
+	}
+	for _, title := range []string{"اجارهٔ ماهانه", "اجاره ماهانه", "اجاره"} {
+		if value, ok := rows[title]; ok {
+			parts = append(parts, "اجاره: "+value)
+			break
+		}
+	}
+	return strings.Join(parts, "، ")
+}
+
 var APIPaths = APIPath{
 	SearchList: "/v8/postlist/w/search",
+	PostDetail: "/v8/posts-v2/web/",
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// ErrPostNotFound is returned by GetPost when the post was removed from Divar.
+var ErrPostNotFound = errors.New("post not found")
+
+// GetPost fetches the page of a post.
+func GetPost(ctx context.Context, token string) (PostDetail, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, APIBaseURL+APIPaths.PostDetail+url.PathEscape(token), nil)
+	if err != nil {
+		return PostDetail{}, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return PostDetail{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return PostDetail{}, ErrPostNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return PostDetail{}, fmt.Errorf("post detail responded with %s", res.Status)
+	}
+
+	var data PostDetail
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return PostDetail{}, err
+	}
+	return data, nil
 }
 
 func Search(curlString string) (SearchRes, error) {
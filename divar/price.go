@@ -0,0 +1,191 @@
+package divar
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PriceKind holds the kinds of prices a post can have.
+//
+// Fields:
+//
+//	Unknown (string): No price was found.
+//	Fixed (string): A sale price.
+//	Rent (string): A deposit and monthly rent pair.
+//	Negotiable (string): The price is "توافقی".
+//	Free (string): The post is "مجانی".
+var PriceKind = struct {
+	Unknown    string
+	Fixed      string
+	Rent       string
+	Negotiable string
+	Free       string
+}{
+	Unknown:    "",
+	Fixed:      "fixed",
+	Rent:       "rent",
+	Negotiable: "negotiable",
+	Free:       "free",
+}
+
+// PostAttributes holds the numeric values parsed from the texts of a post.
+// Amounts are in toman, and are 0 when not given.
+type PostAttributes struct {
+	PriceKind string `json:"priceKind"`
+	Price     int64  `json:"price"`
+	Deposit   int64  `json:"deposit"`
+	Rent      int64  `json:"rent"`
+	Area      int    `json:"area"` // in square meters
+}
+
+// digitNormalizer turns Persian and Arabic digits and separators into ASCII.
+var digitNormalizer = strings.NewReplacer(
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4", "۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4", "٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	"٬", ",", "،", ",", "٫", ".",
+)
+
+// amountPattern matches a number with thousands separators, optionally followed by a scale word.
+var amountPattern = regexp.MustCompile(`(\d[\d,]*(?:\.\d+)?)\s*(هزار|میلیون|میلیارد)?`)
+
+// areaPattern matches an area in square meters, e.g. "۸۵ متر" or "85 متری".
+var areaPattern = regexp.MustCompile(`(\d[\d,]*)\s*(?:متر|m2|m²)`)
+
+// amountScales holds the multipliers of the scale words.
+var amountScales = map[string]float64{
+	"":        1,
+	"هزار":    1e3,
+	"میلیون":  1e6,
+	"میلیارد": 1e9,
+}
+
+// NormalizeDigits replaces Persian and Arabic digits with ASCII digits, the Persian
+// thousands separator and comma with ",", and the Persian decimal separator with ".".
+func NormalizeDigits(text string) string {
+	return digitNormalizer.Replace(text)
+}
+
+// ParseAmount reads the first amount of a text, e.g. "۲٬۵۰۰٬۰۰۰ تومان" or "۱٫۵ میلیارد".
+// Amounts in rial are converted to toman.
+func ParseAmount(text string) (int64, bool) {
+	text = NormalizeDigits(text)
+	match := amountPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	value *= amountScales[match[2]]
+	if strings.Contains(text, "ریال") {
+		value /= 10
+	}
+	if value > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(math.Round(value)), true
+}
+
+// ParseArea reads the first area in square meters of a text.
+func ParseArea(text string) (int, bool) {
+	match := areaPattern.FindStringSubmatch(NormalizeDigits(text))
+	if match == nil {
+		return 0, false
+	}
+	area, err := strconv.Atoi(strings.ReplaceAll(match[1], ",", ""))
+	if err != nil || area <= 0 {
+		return 0, false
+	}
+	return area, true
+}
+
+// labelIndex returns the byte offset of the first of the labels found in a text.
+func labelIndex(text string, labels ...string) int {
+	index := -1
+	for _, label := range labels {
+		if i := strings.Index(text, label); i >= 0 && (index < 0 || i < index) {
+			index = i
+		}
+	}
+	return index
+}
+
+// labeledAmount reads the amount that follows a label, before the label of the other
+// amount of the text, e.g. the deposit of "ودیعه ۲۰۰ میلیون، اجاره ۱۰ میلیون تومان".
+func labeledAmount(text string, at int, other int) (int64, bool) {
+	if at < 0 {
+		return 0, false
+	}
+	segment := text[at:]
+	if other > at {
+		segment = text[at:other]
+	}
+	return ParseAmount(segment)
+}
+
+// PriceAmounts parses the amounts of a single price text: the price of a sale, or the
+// deposit and the rent of a rental. A text without an amount, such as "توافقی", has
+// the PriceKind.Unknown kind.
+func PriceAmounts(text string) PostAttributes {
+	var attributes PostAttributes
+	depositAt := labelIndex(text, "ودیعه", "رهن")
+	rentAt := labelIndex(text, "اجاره")
+	if depositAt >= 0 || rentAt >= 0 {
+		deposit, depositOk := labeledAmount(text, depositAt, rentAt)
+		rent, rentOk := labeledAmount(text, rentAt, depositAt)
+		if depositOk || rentOk {
+			attributes.PriceKind = PriceKind.Rent
+			attributes.Deposit, attributes.Rent = deposit, rent
+		}
+	} else if price, ok := ParseAmount(text); ok {
+		attributes.PriceKind = PriceKind.Fixed
+		attributes.Price = price
+	}
+	return attributes
+}
+
+// Attributes parses the price and area of the post from its title and description texts.
+func (p PostWidget) Attributes() PostAttributes {
+	var attributes PostAttributes
+	texts := []string{p.Data.TopDescriptionText, p.Data.MiddleDescriptionText, p.Data.BottomDescriptionText}
+
+	for _, text := range texts {
+		depositAt := labelIndex(text, "ودیعه", "رهن")
+		rentAt := labelIndex(text, "اجاره")
+		switch {
+		case depositAt >= 0 || rentAt >= 0:
+			// a text may hold the deposit, the rent, or both
+			if deposit, ok := labeledAmount(text, depositAt, rentAt); ok {
+				attributes.Deposit = deposit
+			}
+			if rent, ok := labeledAmount(text, rentAt, depositAt); ok {
+				attributes.Rent = rent
+			}
+			attributes.PriceKind = PriceKind.Rent
+		case strings.Contains(text, "توافقی"):
+			if attributes.PriceKind == PriceKind.Unknown {
+				attributes.PriceKind = PriceKind.Negotiable
+			}
+		case strings.Contains(text, "مجانی") || strings.Contains(text, "رایگان"):
+			if attributes.PriceKind == PriceKind.Unknown {
+				attributes.PriceKind = PriceKind.Free
+			}
+		case strings.Contains(text, "تومان") || strings.Contains(text, "ریال"):
+			if price, ok := ParseAmount(text); ok && attributes.PriceKind != PriceKind.Rent {
+				attributes.Price = price
+				attributes.PriceKind = PriceKind.Fixed
+			}
+		}
+	}
+
+	for _, text := range append([]string{p.Data.Title}, texts...) {
+		if area, ok := ParseArea(text); ok {
+			attributes.Area = area
+			break
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,153 @@
+package divar
+
+import "testing"
+
+func TestNormalizeDigits(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"۱۲۳۴۵۶۷۸۹۰", "1234567890"},
+		{"١٢٣٤٥٦٧٨٩٠", "1234567890"},
+		{"۲٬۵۰۰٬۰۰۰", "2,500,000"},
+		{"۱٫۵ میلیارد", "1.5 میلیارد"},
+		{"۸۵ متر، ۲ خواب", "85 متر, 2 خواب"},
+		{"no digits", "no digits"},
+	}
+	for _, test := range tests {
+		if got := NormalizeDigits(test.text); got != test.want {
+			t.Errorf("NormalizeDigits(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int64
+		ok   bool
+	}{
+		{"۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان", 2_500_000_000, true},
+		{"2,500,000 تومان", 2_500_000, true},
+		{"۱٫۵ میلیارد تومان", 1_500_000_000, true},
+		{"۸۰۰ میلیون", 800_000_000, true},
+		{"۵۰ هزار تومان", 50_000, true},
+		{"۱۰٬۰۰۰٬۰۰۰ ریال", 1_000_000, true},
+		{"ودیعه ۲۰۰ میلیون", 200_000_000, true},
+		{"توافقی", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseAmount(test.text)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d, %v", test.text, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseArea(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+		ok   bool
+	}{
+		{"آپارتمان ۸۵ متری", 85, true},
+		{"۱۲۰ متر", 120, true},
+		{"1,200 متر زمین", 1200, true},
+		{"85m2", 85, true},
+		{"۰ متر", 0, false},
+		{"آپارتمان نوساز", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseArea(test.text)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ParseArea(%q) = %d, %v, want %d, %v", test.text, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPriceAmounts(t *testing.T) {
+	tests := []struct {
+		text string
+		want PostAttributes
+	}{
+		{"۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان", PostAttributes{PriceKind: PriceKind.Fixed, Price: 2_500_000_000}},
+		{"۲٫۵ میلیارد تومان", PostAttributes{PriceKind: PriceKind.Fixed, Price: 2_500_000_000}},
+		{"ودیعه: ۲۰۰ میلیون تومان، اجاره: ۱۰ میلیون تومان", PostAttributes{PriceKind: PriceKind.Rent, Deposit: 200_000_000, Rent: 10_000_000}},
+		{"اجارهٔ ماهانه: ۱۰٬۰۰۰٬۰۰۰ تومان", PostAttributes{PriceKind: PriceKind.Rent, Rent: 10_000_000}},
+		{"رهن کامل ۱ میلیارد تومان", PostAttributes{PriceKind: PriceKind.Rent, Deposit: 1_000_000_000}},
+		{"توافقی", PostAttributes{}},
+		{"", PostAttributes{}},
+	}
+	for _, test := range tests {
+		if got := PriceAmounts(test.text); got != test.want {
+			t.Errorf("PriceAmounts(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		top    string
+		middle string
+		bottom string
+		want   PostAttributes
+	}{
+		{
+			name:   "sale",
+			title:  "آپارتمان ۸۵ متری",
+			middle: "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان",
+			want:   PostAttributes{PriceKind: PriceKind.Fixed, Price: 2_500_000_000, Area: 85},
+		},
+		{
+			name:   "deposit and rent in separate texts",
+			title:  "اجاره ۶۰ متر",
+			top:    "ودیعه: ۲۰۰ میلیون تومان",
+			middle: "اجارهٔ ماهانه: ۱۰ میلیون تومان",
+			want:   PostAttributes{PriceKind: PriceKind.Rent, Deposit: 200_000_000, Rent: 10_000_000, Area: 60},
+		},
+		{
+			name:   "deposit and rent in one text",
+			middle: "ودیعه ۲۰۰ میلیون، اجاره ۱۰ میلیون تومان",
+			want:   PostAttributes{PriceKind: PriceKind.Rent, Deposit: 200_000_000, Rent: 10_000_000},
+		},
+		{
+			name:   "rent before deposit in one text",
+			middle: "اجاره ۱۵٬۰۰۰٬۰۰۰ / رهن ۳۰۰٬۰۰۰٬۰۰۰ تومان",
+			want:   PostAttributes{PriceKind: PriceKind.Rent, Deposit: 300_000_000, Rent: 15_000_000},
+		},
+		{
+			name:   "full mortgage",
+			middle: "رهن کامل ۱ میلیارد تومان",
+			want:   PostAttributes{PriceKind: PriceKind.Rent, Deposit: 1_000_000_000},
+		},
+		{
+			name:   "negotiable",
+			middle: "توافقی",
+			bottom: "۱۲۰ متر",
+			want:   PostAttributes{PriceKind: PriceKind.Negotiable, Area: 120},
+		},
+		{
+			name:   "free",
+			middle: "مجانی",
+			want:   PostAttributes{PriceKind: PriceKind.Free},
+		},
+		{
+			name:  "no price",
+			title: "میز تحریر",
+			want:  PostAttributes{},
+		},
+	}
+	for _, test := range tests {
+		var post PostWidget
+		post.Data.Title = test.title
+		post.Data.TopDescriptionText = test.top
+		post.Data.MiddleDescriptionText = test.middle
+		post.Data.BottomDescriptionText = test.bottom
+		if got := post.Attributes(); got != test.want {
+			t.Errorf("%s: Attributes() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package divar
+
+import "strings"
+
+// ListingStatus holds the states of a post on Divar.
+//
+// Fields:
+//
+//	Active (string): The post is published.
+//	Removed (string): The post was deleted or expired.
+//	Sold (string): The post was marked as sold.
+//	Rented (string): The post was marked as rented.
+var ListingStatus = struct {
+	Active  string
+	Removed string
+	Sold    string
+	Rented  string
+}{
+	Active:  "active",
+	Removed: "removed",
+	Sold:    "sold",
+	Rented:  "rented",
+}
+
+// closedBannerWidgetType is the type of the widget that shows the banner on top of the page of a closed post.
+const closedBannerWidgetType = "ALERT_BOX"
+
+// statusPhrases maps the texts of the banner of a closed post to its status, checked in order.
+var statusPhrases = []struct {
+	Phrase string
+	Status string
+}{
+	{"فروخته شد", ListingStatus.Sold},
+	{"اجاره داده شد", ListingStatus.Rented},
+	{"حذف شده", ListingStatus.Removed},
+	{"منقضی شده", ListingStatus.Removed},
+	{"غیرفعال شده", ListingStatus.Removed},
+}
+
+// Status reads the status of the post from the banner shown on the page of a closed post.
+// Other widgets are ignored, as the description of an active post may well contain the
+// same phrases. Posts that are no longer found by GetPost are ListingStatus.Removed.
+func (d PostDetail) Status() string {
+	for _, section := range d.Sections {
+		for _, widget := range section.Widgets {
+			if widget.WidgetType != closedBannerWidgetType {
+				continue
+			}
+			text := widget.Data.Title + " " + widget.Data.Value
+			for _, phrase := range statusPhrases {
+				if strings.Contains(text, phrase.Phrase) {
+					return phrase.Status
+				}
+			}
+		}
+	}
+	return ListingStatus.Active
+}
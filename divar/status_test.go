@@ -0,0 +1,62 @@
+package divar
+
+import "testing"
+
+// detailWithWidget builds the page of a post with a single widget.
+func detailWithWidget(widgetType string, title string) PostDetail {
+	var widget DetailWidget
+	widget.WidgetType = widgetType
+	widget.Data.Title = title
+	var detail PostDetail
+	detail.Sections = append(detail.Sections, struct {
+		SectionName string         `json:"section_name"`
+		Widgets     []DetailWidget `json:"widgets"`
+	}{SectionName: "TITLE", Widgets: []DetailWidget{widget}})
+	return detail
+}
+
+func TestPostDetailStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		detail PostDetail
+		want   string
+	}{
+		{"sold banner", detailWithWidget(closedBannerWidgetType, "این آگهی فروخته شد"), ListingStatus.Sold},
+		{"rented banner", detailWithWidget(closedBannerWidgetType, "این ملک اجاره داده شد"), ListingStatus.Rented},
+		{"removed banner", detailWithWidget(closedBannerWidgetType, "این آگهی حذف شده است"), ListingStatus.Removed},
+		{"phrase in the description", detailWithWidget("DESCRIPTION_ROW", "واحد کناری فروخته شد"), ListingStatus.Active},
+		{"no banner", PostDetail{}, ListingStatus.Active},
+	}
+	for _, test := range tests {
+		if got := test.detail.Status(); got != test.want {
+			t.Errorf("%s: Status() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPostDetailPrice(t *testing.T) {
+	row := func(title string, value string) DetailWidget {
+		var widget DetailWidget
+		widget.WidgetType = "UNEXPANDABLE_ROW"
+		widget.Data.Title = title
+		widget.Data.Value = value
+		return widget
+	}
+	tests := []struct {
+		name string
+		rows []DetailWidget
+		want string
+	}{
+		{"sale", []DetailWidget{row("متراژ", "۸۵"), row("قیمت کل", "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان")}, "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان"},
+		{"rent", []DetailWidget{row("ودیعه", "۲۰۰ میلیون تومان"), row("اجارهٔ ماهانه", "۱۰ میلیون تومان")}, "ودیعه: ۲۰۰ میلیون تومان، اجاره: ۱۰ میلیون تومان"},
+		{"full mortgage", []DetailWidget{row("ودیعه", "۱ میلیارد تومان")}, "ودیعه: ۱ میلیارد تومان"},
+		{"no price", []DetailWidget{row("متراژ", "۸۵")}, ""},
+	}
+	for _, test := range tests {
+		detail := detailWithWidget("TITLE_ROW", "")
+		detail.Sections[0].Widgets = test.rows
+		if got := detail.Price(); got != test.want {
+			t.Errorf("%s: Price() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
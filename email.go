@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/mrmohebi/divar-alert/divar"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailTemplate renders the HTML body of notification emails, for a single post or a digest.
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html dir="{{.Dir}}" lang="{{.Lang}}">
+<body style="font-family: Tahoma, sans-serif;">
+<h3>{{.Heading}}</h3>
+{{range .Posts}}
+<div style="margin-bottom: 24px;">
+	{{if .Data.ImageURL}}<img src="{{.Data.ImageURL}}" alt="" style="max-width: 320px;"><br>{{end}}
+	<strong>{{.Data.Title}}</strong><br>
+	{{if .Data.TopDescriptionText}}{{.Data.TopDescriptionText}}<br>{{end}}
+	{{if .Data.MiddleDescriptionText}}{{.Data.MiddleDescriptionText}}<br>{{end}}
+	{{if .Data.BottomDescriptionText}}{{.Data.BottomDescriptionText}}<br>{{end}}
+	<a href="https://divar.ir/v/{{.Data.Token}}">{{$.LinkText}}</a>
+</div>
+{{end}}
+</body>
+</html>`))
+
+// EmailNotifier delivers notifications as HTML emails through an SMTP server.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	StartTLS bool
+}
+
+// loadEmailNotifier reads the SMTP settings from the environment.
+//
+// Returns:
+//
+//	*EmailNotifier: The email notifier, or nil if SMTP_HOST is not set.
+//	error: An error if the settings are invalid, otherwise nil.
+func loadEmailNotifier() (*EmailNotifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+
+	n := &EmailNotifier{
+		Host:     host,
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		StartTLS: true,
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		var err error
+		if n.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+	}
+	if startTLS := os.Getenv("SMTP_STARTTLS"); startTLS != "" {
+		var err error
+		if n.StartTLS, err = strconv.ParseBool(startTLS); err != nil {
+			return nil, fmt.Errorf("invalid SMTP_STARTTLS: %w", err)
+		}
+	}
+	if n.From == "" {
+		n.From = n.Username
+	}
+	if _, err := mail.ParseAddress(n.From); err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	return n, nil
+}
+
+func (n *EmailNotifier) Send(ctx context.Context, recipient Recipient, notification PostNotification) error {
+	lang := chatLang(notification.Alert.Bot, notification.Alert.ChatId)
+	subject := tr(lang, "email.subject", notification.Alert.Title, notification.Post.Data.Title)
+	heading := tr(lang, "email.heading", notification.Alert.Title)
+	posts := []divar.PostWidget{notification.Post}
+	if len(notification.Digest) > 0 {
+		subject = tr(lang, "email.digestSubject", len(notification.Digest), notification.Alert.Title)
+		heading = subject
+		posts = notification.Digest
+	}
+
+	dir := "rtl"
+	if lang == Lang.En {
+		dir = "ltr"
+	}
+	var body bytes.Buffer
+	err := emailTemplate.Execute(&body, struct {
+		Lang     string
+		Dir      string
+		Heading  string
+		LinkText string
+		Posts    []divar.PostWidget
+	}{lang, dir, heading, tr(lang, "email.link"), posts})
+	if err != nil {
+		return err
+	}
+	return n.sendMail(ctx, recipient.Address, subject, body.Bytes())
+}
+
+// sendMail sends an HTML email through the SMTP server.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery, its deadline bounds the SMTP session.
+//	to (string): The address of the recipient.
+//	subject (string): The subject of the email.
+//	html ([]byte): The HTML body of the email.
+//
+// Returns:
+//
+//	error: An error if the email cannot be sent, otherwise nil.
+func (n *EmailNotifier) sendMail(ctx context.Context, to string, subject string, html []byte) error {
+	address := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if n.StartTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, _ := mail.ParseAddress(n.From)
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from.String() + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(html)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// setAlertEmail sets the email address that receives the notifications of an alert.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): The email address, or "off" to stop sending emails.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if email is not configured or the address is invalid, otherwise nil.
+func setAlertEmail(alert *Alert, value string) error {
+	if value == "off" {
+		alert.Email = ""
+		return nil
+	}
+	if _, ok := notifiers[Channel.Email]; !ok {
+		return &ProcessInputError{Key: "edit.email.notConfigured"}
+	}
+	address, err := mail.ParseAddress(value)
+	if err != nil || strings.ContainsAny(address.Address, "\r\n") {
+		return &ProcessInputError{Key: "edit.email.invalid"}
+	}
+	alert.Email = address.Address
+	return nil
+}
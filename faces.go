@@ -1,10 +1,122 @@
 package main
 
+import "github.com/mrmohebi/divar-alert/divar"
+
 type Alert struct {
-	Id              int64  `json:"id"`
-	Title           string `json:"title"`
-	Link            string `json:"link"`
-	Interval        int    `json:"interval"` // in seconds
-	ChatId          int64  `json:"chatId"`
-	LastTimeChecked int64  `json:"lastTimeChecked"` // timestamp of the last check
+	Id              int64    `json:"id"`
+	Title           string   `json:"title"`
+	Link            string   `json:"link"`
+	Interval        int      `json:"interval"` // in seconds
+	ChatId          int64    `json:"chatId"`
+	Bot             string   `json:"bot"`             // name of the bot the alert was created on
+	LastTimeChecked int64    `json:"lastTimeChecked"` // timestamp of the last check
+	Paused          bool     `json:"paused"`
+	PausedAt        int64    `json:"pausedAt"`       // timestamp of the last pause
+	MarkSeenOnce    bool     `json:"markSeenOnce"`   // mark posts of the next check as seen without notifying
+	DigestPeriod    int      `json:"digestPeriod"`   // in seconds, 0 sends every post immediately
+	DigestStyle     string   `json:"digestStyle"`    // one of DigestStyle
+	LastDigestAt    int64    `json:"lastDigestAt"`   // timestamp of the last sent digest
+	WebhookURL      string   `json:"webhookUrl"`     // new posts are also posted here as JSON, empty when disabled
+	WebhookSecret   string   `json:"webhookSecret"`  // key of the HMAC signature of webhook requests
+	Email           string   `json:"email"`          // new posts are also emailed here, empty when disabled
+	Template        string   `json:"template"`       // text/template of the notification text, empty for the default of the chat language
+	Album           bool     `json:"album"`          // send all images of a post as a media group instead of the thumbnail
+	MutedUntil      int64    `json:"mutedUntil"`     // timestamp until which notifications of this alert are muted
+	Include         []string `json:"include"`        // normalized keywords of which a post must contain one, empty for any post
+	Exclude         []string `json:"exclude"`        // normalized keywords that a post must not contain
+	Regex           string   `json:"regex"`          // regular expression that a post must match, empty for any post
+	Rule            string   `json:"rule"`           // numeric rule that a post must pass, e.g. "price/area < 80m", empty for any post
+	Reposts         string   `json:"reposts"`        // how reposts of earlier posts are handled, one of RepostMode
+	PriceChanges    bool     `json:"priceChanges"`   // send price changes of the posts already sent
+	PriceThreshold  float64  `json:"priceThreshold"` // minimum price change in percent that is sent
+	DealPercentile  float64  `json:"dealPercentile"` // only posts as cheap per square meter as this percentile of recent posts are sent, 0 for any post
+}
+
+type Chat struct {
+	Id          int64  `json:"id"`
+	Bot         string `json:"bot"`         // name of the bot of the chat
+	SnoozeUntil int64  `json:"snoozeUntil"` // timestamp until which notifications of all alerts are muted
+	QuietStart  string `json:"quietStart"`  // start of quiet hours as "HH:MM" in Tehran time, empty when disabled
+	QuietEnd    string `json:"quietEnd"`    // end of quiet hours as "HH:MM" in Tehran time, empty when disabled
+	Lang        string `json:"lang"`        // language of bot messages, empty for the default
+	Dedup       bool   `json:"dedup"`       // send a post matched by several alerts only once
+}
+
+type DeferredPost struct {
+	Bot         string           `json:"bot"`
+	AlertId     int64            `json:"alertId"`
+	AlertTitle  string           `json:"alertTitle"`
+	Post        divar.PostWidget `json:"post"`
+	Emailed     bool             `json:"emailed"`               // already handed to the email digest
+	AlsoMatched []string         `json:"alsoMatched,omitempty"` // titles of the other alerts of the chat that matched the post while it was queued
+	Note        string           `json:"note,omitempty"`        // why the post is sent again, e.g. the change of its price
+}
+
+type OutboxItem struct {
+	Key           string             `json:"key"`
+	Recipient     Recipient          `json:"recipient"`
+	Alert         Alert              `json:"alert"` // the alert as it was when the post was found
+	Post          divar.PostWidget   `json:"post"`
+	Digest        []divar.PostWidget `json:"digest,omitempty"` // posts of a digest notification
+	CreatedAt     int64              `json:"createdAt"`
+	Attempts      int                `json:"attempts"`      // number of failed deliveries
+	NextAttemptAt int64              `json:"nextAttemptAt"` // timestamp before which no delivery is attempted
+	LastError     string             `json:"lastError"`
+	PreviousPrice string             `json:"previousPrice,omitempty"` // price before the change, for price change notifications
+	AlsoMatched   []string           `json:"alsoMatched,omitempty"`   // titles of the other alerts of the chat that matched the post
+	RepostOf      string             `json:"repostOf,omitempty"`      // token of the earlier post the post is a repost of
+	ListingStatus string             `json:"listingStatus,omitempty"` // status of a saved or tracked post that was closed, one of divar.ListingStatus
+	Deal          *DealScore         `json:"deal,omitempty"`          // price per square meter of the post compared with recent posts of the alert
+}
+
+// SeenPost is the seen marker of a post found by an alert. The post is embedded, so the marker
+// is the JSON document of the post with the flag added.
+type SeenPost struct {
+	divar.PostWidget
+	Skipped bool `json:"skipped,omitempty"` // the chat did not get the post, e.g. while muted, so it gets no price changes either
+}
+
+// Favorite is a post saved by a chat. It is kept after the alert that found it is deleted.
+type Favorite struct {
+	Bot        string           `json:"bot"` // name of the bot the post was saved on
+	Token      string           `json:"token"`
+	AlertTitle string           `json:"alertTitle"`
+	Post       divar.PostWidget `json:"post"`
+	SavedAt    int64            `json:"savedAt"`
+}
+
+// TrackedPost is a post whose price changes are sent to a chat.
+type TrackedPost struct {
+	Bot        string           `json:"bot"`
+	AlertId    int64            `json:"alertId"`
+	AlertTitle string           `json:"alertTitle"`
+	Post       divar.PostWidget `json:"post"`
+	Price      string           `json:"price"` // last seen price text
+	TrackedAt  int64            `json:"trackedAt"`
+}
+
+// ListingEvent is an event in the history of a post.
+type ListingEvent struct {
+	Kind  string `json:"kind"`  // one of ListingEventKind
+	Price string `json:"price"` // price text of the post at the event
+	At    int64  `json:"at"`
+}
+
+// ListingHistory is the lifecycle of a post on Divar, from when an alert first found it
+// until it was removed, sold or rented.
+type ListingHistory struct {
+	Token      string         `json:"token"`
+	Title      string         `json:"title"`
+	Status     string         `json:"status"` // one of divar.ListingStatus
+	Events     []ListingEvent `json:"events"`
+	LastSeenAt int64          `json:"lastSeenAt"` // timestamp of the last time an alert listed the post
+	ClosedAt   int64          `json:"closedAt"`   // timestamp at which the post was found closed, 0 while active
+	Kept       bool           `json:"kept"`       // the post was saved or tracked, so its history does not expire
+}
+
+// PriceRecord is the parsed price and area of a post listed by an alert.
+type PriceRecord struct {
+	Token  string `json:"token"`
+	SeenAt int64  `json:"seenAt"` // timestamp at which the alert first listed the post
+	divar.PostAttributes
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// favoriteStatusWorkers is the number of post pages fetched at once to show the status of favorites.
+const favoriteStatusWorkers = 5
+
+// favoriteKey builds the database key under which a saved post of a chat is stored.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the favorite.
+func favoriteKey(botName string, chatId int64, token string) []byte {
+	return []byte(fmt.Sprintf("favorite-%s-%s", chatScope(botName, chatId), token))
+}
+
+// listFavorites reads the saved posts of a chat, oldest first.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	[]Favorite: The saved posts.
+//	error: An error if the favorites cannot be read, otherwise nil.
+func listFavorites(botName string, chatId int64) ([]Favorite, error) {
+	var favorites []Favorite
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(fmt.Sprintf("favorite-%s-", chatScope(botName, chatId)))
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var favorite Favorite
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &favorite)
+			})
+			if err != nil {
+				sugar.Errorw("Failed to unmarshal favorite", "error", err, "key", string(it.Item().Key()))
+				continue
+			}
+			favorites = append(favorites, favorite)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(favorites, func(a, b Favorite) int {
+		return cmp.Compare(a.SavedAt, b.SavedAt)
+	})
+	return favorites, nil
+}
+
+// favoriteHistories reads the histories of the saved posts.
+//
+// Parameters:
+//
+//	favorites ([]Favorite): The saved posts.
+//
+// Returns:
+//
+//	map[string]ListingHistory: The history of each saved post that has one, by token.
+func favoriteHistories(favorites []Favorite) map[string]ListingHistory {
+	histories := map[string]ListingHistory{}
+	err := db.View(func(txn *badger.Txn) error {
+		for _, favorite := range favorites {
+			history, err := getListingHistory(txn, favorite.Token)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			histories[favorite.Token] = history
+		}
+		return nil
+	})
+	if err != nil {
+		sugar.Errorw("Failed to read favorite histories", "error", err)
+	}
+	return histories
+}
+
+// favoriteStatuses looks up whether the saved posts are still published on Divar. Posts
+// whose history already records them as closed are not looked up again.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the requests.
+//	favorites ([]Favorite): The saved posts.
+//	histories (map[string]ListingHistory): The histories of the saved posts, by token.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	[]string: The status of each saved post, in the same order.
+func favoriteStatuses(ctx context.Context, favorites []Favorite, histories map[string]ListingHistory, lang string) []string {
+	statuses := make([]string, len(favorites))
+	workers := make(chan struct{}, favoriteStatusWorkers)
+	var wg sync.WaitGroup
+	for i, favorite := range favorites {
+		if history, ok := histories[favorite.Token]; ok && history.ClosedAt > 0 {
+			statuses[i] = tr(lang, "listing.status."+history.Status)
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			detail, err := divar.GetPost(ctx, favorite.Token)
+			switch {
+			case err == nil:
+				statuses[i] = tr(lang, "listing.status."+detail.Status())
+			case errors.Is(err, divar.ErrPostNotFound):
+				statuses[i] = tr(lang, "listing.status."+divar.ListingStatus.Removed)
+			default:
+				sugar.Errorw("Failed to read favorite status", "error", err, "token", favorite.Token)
+				statuses[i] = tr(lang, "favorites.status.unknown")
+			}
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// favoritesCSV exports the saved posts of a chat as a CSV file.
+//
+// Parameters:
+//
+//	favorites ([]Favorite): The saved posts.
+//	histories (map[string]ListingHistory): The histories of the saved posts, by token.
+//
+// Returns:
+//
+//	[]byte: The CSV file, with a byte order mark so spreadsheets read it as UTF-8.
+//	error: An error if the file cannot be written, otherwise nil.
+func favoritesCSV(favorites []Favorite, histories map[string]ListingHistory) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("\ufeff")
+	w := csv.NewWriter(&out)
+	w.Write([]string{"token", "title", "price", "alert", "url", "savedAt", "firstSeenAt", "status", "closedAt"})
+	for _, favorite := range favorites {
+		history := histories[favorite.Token]
+		w.Write([]string{
+			favorite.Token,
+			favorite.Post.Data.Title,
+			postPrice(favorite.Post),
+			favorite.AlertTitle,
+			postURL(favorite.Token),
+			time.Unix(favorite.SavedAt, 0).In(tehran).Format(time.DateTime),
+			formatDate(history.FirstSeenAt()),
+			history.Status,
+			formatDate(history.ClosedAt),
+		})
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+func handlerFavorites(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	favorites, err := listFavorites(botName(b), chatId)
+	if err != nil {
+		sugar.Errorw("Failed to list favorites", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "favorites.error"),
+		})
+		return
+	}
+
+	if len(favorites) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "favorites.empty"),
+		})
+		return
+	}
+
+	if commandArgs(update.Message.Text) == "export" {
+		file, err := favoritesCSV(favorites, favoriteHistories(favorites))
+		if err != nil {
+			sugar.Errorw("Failed to export favorites", "error", err)
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatId,
+				Text:   tr(lang, "favorites.error"),
+			})
+			return
+		}
+		b.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:   chatId,
+			Document: &models.InputFileUpload{Filename: "favorites.csv", Data: bytes.NewReader(file)},
+		})
+		return
+	}
+
+	histories := favoriteHistories(favorites)
+	statuses := favoriteStatuses(ctx, favorites, histories, lang)
+	var text string
+	var keyboard [][]models.InlineKeyboardButton
+	flush := func() {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:             chatId,
+			Text:               text,
+			LinkPreviewOptions: &models.LinkPreviewOptions{IsDisabled: bot.True()},
+			ReplyMarkup:        &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		})
+		text = ""
+		keyboard = nil
+	}
+	for i, favorite := range favorites {
+		summary := listingSummary(histories[favorite.Token], lang)
+		line := tr(lang, "favorites.item", i+1, favorite.Post.Data.Title, postPrice(favorite.Post), statuses[i], summary, postURL(favorite.Token))
+		if text != "" && textLength(text+line) > maxMessageLength {
+			flush()
+		}
+		text += line
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         tr(lang, "button.unsave", strconv.Itoa(i+1)),
+			CallbackData: "unsave_post-" + favorite.Token,
+		}})
+	}
+	text += tr(lang, "favorites.exportHint")
+	flush()
+}
+
+func handlerCallbackUnsavePost(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.CallbackQuery.Message.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	token := update.CallbackQuery.Data[len("unsave_post-"):]
+	err := db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(favoriteKey(botName(b), chatId, token))
+	})
+	text := tr(lang, "favorites.removed")
+	if err != nil {
+		sugar.Errorw("Failed to remove favorite", "error", err)
+		text = tr(lang, "action.error")
+	}
+
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"github.com/mrmohebi/divar-alert/divar"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// skipValue is entered in a wizard step to leave an optional setting empty.
+const skipValue = "-"
+
+// keywordNormalizer unifies the Arabic and Persian forms of letters, so keywords match either spelling.
+var keywordNormalizer = strings.NewReplacer("ي", "ی", "ك", "ک", "ى", "ی", "\u200c", " ")
+
+// normalizeKeywordText prepares a text for keyword matching.
+//
+// Parameters:
+//
+//	text (string): The text.
+//
+// Returns:
+//
+//	string: The lowercased text with unified letters and single spaces.
+func normalizeKeywordText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(keywordNormalizer.Replace(text))), " ")
+}
+
+// parseKeywords splits a comma separated keyword list.
+//
+// Parameters:
+//
+//	value (string): The keywords separated by "," or "،", or "-" or "off" for none.
+//
+// Returns:
+//
+//	[]string: The normalized keywords, nil if there are none.
+func parseKeywords(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == skipValue || value == "off" {
+		return nil
+	}
+	var keywords []string
+	for _, keyword := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '،' }) {
+		if keyword = normalizeKeywordText(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// postText returns the text of a post that filters are applied to.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	string: The title and descriptions of the post, one per line.
+func postText(post divar.PostWidget) string {
+	return strings.Join([]string{
+		post.Data.Title,
+		post.Data.TopDescriptionText,
+		post.Data.MiddleDescriptionText,
+		post.Data.BottomDescriptionText,
+	}, "\n")
+}
+
+// compiledRegex is the result of compiling the regex filter of an alert, kept by compiledRegexes.
+type compiledRegex struct {
+	pattern string
+	re      *regexp.Regexp
+	err     error
+}
+
+// compiledRegexes caches the compiled regex filter of each alert by the key of the alert, as every
+// post of an alert is checked against the same one. It holds one entry per alert, which is
+// replaced when the regex of the alert changes and removed when the alert is deleted.
+var compiledRegexes sync.Map
+
+// cachedRegex compiles the regex filter of an alert once and returns the cached result
+// afterwards, until the regex changes.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//
+// Returns:
+//
+//	*regexp.Regexp: The compiled regex.
+//	error: An error if the regex is invalid, otherwise nil.
+func cachedRegex(alert Alert) (*regexp.Regexp, error) {
+	key := string(alertKey(alert.Bot, alert.ChatId, alert.Id))
+	if cached, ok := compiledRegexes.Load(key); ok && cached.(compiledRegex).pattern == alert.Regex {
+		return cached.(compiledRegex).re, cached.(compiledRegex).err
+	}
+	re, err := regexp.Compile(alert.Regex)
+	compiledRegexes.Store(key, compiledRegex{pattern: alert.Regex, re: re, err: err})
+	return re, err
+}
+
+// matchesFilters reports whether a post passes the keyword and regex filters of an alert.
+// A post passes if it contains at least one include keyword, when there are any,
+// no exclude keyword, and matches the regex, when there is one.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	bool: True if the post should be sent, otherwise false.
+func matchesFilters(alert Alert, post divar.PostWidget) bool {
+	text := postText(post)
+	normalized := normalizeKeywordText(text)
+
+	if len(alert.Include) > 0 {
+		included := false
+		for _, keyword := range alert.Include {
+			if strings.Contains(normalized, keyword) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, keyword := range alert.Exclude {
+		if strings.Contains(normalized, keyword) {
+			return false
+		}
+	}
+	if alert.Regex != "" {
+		re, err := cachedRegex(alert)
+		if err != nil {
+			sugar.Errorw("Invalid alert regex", "error", err, "alert", alert.Title)
+			return true
+		}
+		return re.MatchString(text)
+	}
+	return true
+}
+
+// setAlertInclude sets the keywords of which a post of an alert must contain at least one.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): The keywords separated by commas, or "off" to remove them.
+//
+// Returns:
+//
+//	error: Always nil.
+func setAlertInclude(alert *Alert, value string) error {
+	alert.Include = parseKeywords(value)
+	return nil
+}
+
+// setAlertExclude sets the keywords that a post of an alert must not contain.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): The keywords separated by commas, or "off" to remove them.
+//
+// Returns:
+//
+//	error: Always nil.
+func setAlertExclude(alert *Alert, value string) error {
+	alert.Exclude = parseKeywords(value)
+	return nil
+}
+
+// setAlertRegex sets the regular expression that a post of an alert must match.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): A Go regular expression, or "off" to remove it.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the regular expression is invalid, otherwise nil.
+func setAlertRegex(alert *Alert, value string) error {
+	if value == "off" {
+		alert.Regex = ""
+		return nil
+	}
+	if _, err := regexp.Compile(value); err != nil {
+		return &ProcessInputError{Key: "edit.regex.invalid", Args: []any{err.Error()}}
+	}
+	alert.Regex = value
+	return nil
+}
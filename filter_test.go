@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestMatchesFilters(t *testing.T) {
+	openTestDB(t)
+	post := testPost("a", "آپارتمان ۸۰ متری پاركینگ دار")
+	post.Data.MiddleDescriptionText = "۵٬۰۰۰٬۰۰۰٬۰۰۰ تومان"
+	tests := []struct {
+		name  string
+		alert Alert
+		want  bool
+	}{
+		{"no filters", Alert{}, true},
+		{"include in another spelling", Alert{Include: []string{"پارکینگ"}}, true},
+		{"include missing", Alert{Include: []string{"آسانسور"}}, false},
+		{"exclude", Alert{Exclude: []string{"آپارتمان"}}, false},
+		{"regex", Alert{Regex: `[۰-۹]+ متری`}, true},
+		{"regex without match", Alert{Regex: `^ویلا`}, false},
+		{"invalid regex", Alert{Regex: `(`}, true},
+	}
+	for _, test := range tests {
+		// twice, to check the cached regex as well
+		for i := 0; i < 2; i++ {
+			if got := matchesFilters(test.alert, post); got != test.want {
+				t.Errorf("%s: matchesFilters() = %v, want %v", test.name, got, test.want)
+			}
+		}
+	}
+	// the cache holds the last regex of the alert
+	cached, ok := compiledRegexes.Load(string(alertKey("", 0, 0)))
+	if !ok || cached.(compiledRegex).pattern != tests[len(tests)-1].alert.Regex {
+		t.Errorf("cached regex = %+v, want the regex of the last alert", cached)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// openTestDB replaces the database with an in-memory one for the duration of a test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	sugar = zap.NewNop().Sugar()
+	memory, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	db = memory
+	t.Cleanup(func() {
+		db = previous
+		memory.Close()
+	})
+}
+
+// setTestBots replaces the running bots with bots of the given names, without a client.
+func setTestBots(t *testing.T, names ...string) {
+	t.Helper()
+	previous := bots
+	bots = nil
+	for _, name := range names {
+		bots = append(bots, &botInstance{Name: name, Limiter: newSendLimiter(globalSendRate, chatSendRate)})
+	}
+	t.Cleanup(func() {
+		bots = previous
+	})
+}
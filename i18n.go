@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Lang holds the supported languages of bot messages.
+//
+// Fields:
+//
+//	Fa (string): Persian, the default language.
+//	En (string): English.
+var Lang = struct {
+	Fa string
+	En string
+}{
+	Fa: "fa",
+	En: "en",
+}
+
+// defaultLang is the language of chats that did not choose one.
+var defaultLang = Lang.Fa
+
+// catalog holds the bot messages of every language, by message key.
+// Messages with arguments are fmt format strings.
+var catalog = map[string]map[string]string{
+	Lang.Fa: {
+		"default.chooseCommand": "لطفا یکی از دستورات را انتخاب کنید.",
+		"process.error":         "خطا در ادامه فرآیند.",
+
+		"step.title":     "لطفا عنوان اعلان را ارسال کنید:",
+		"step.link":      "لطفا لینک دیوار را ارسال کنید:",
+		"step.interval":  "هر چند ثانیه میخواهید چک شود؟",
+		"step.delivery":  "برای ارسال فوری هر آگهی 0 بفرستید، یا برای دریافت خلاصه دوره‌ای تعداد دقیقه‌های هر دوره را بفرستید (مثلا 60). برای دریافت خلاصه به صورت آلبوم عکس، بعد از عدد album بنویسید (مثلا 60 album).",
+		"step.include":   "فقط آگهی‌هایی که یکی از این کلمات را دارند ارسال شوند؟ کلمات را با کاما جدا کنید (مثلا: نوساز، پارکینگ)، یا - بفرستید.",
+		"step.exclude":   "آگهی‌هایی که یکی از این کلمات را دارند ارسال نشوند؟ کلمات را با کاما جدا کنید (مثلا: همکاری، رهن کامل)، یا - بفرستید.",
+		"step.setEnd":    "اعلان با موفقیت تنظیم شد.",
+		"step.editAlert": "لطفا شماره اعلان را از فهرست /alertList ارسال کنید:",
+		"step.editField": "کدام تنظیم را می‌خواهید تغییر دهید؟\n",
+		"step.editValue": "لطفا مقدار جدید را ارسال کنید:",
+		"step.editEnd":   "اعلان با موفقیت ویرایش شد.",
+
+		"alert.set.startError":  "خطا در شروع فرآیند تنظیم هشدار.",
+		"alert.edit.startError": "خطا در شروع فرآیند ویرایش اعلان.",
+		"alert.delete.error":    "خطا در حذف اعلان.",
+		"alert.delete.done":     "اعلان با موفقیت حذف شد.",
+		"alert.list.error":      "خطا در دریافت اعلان‌ها.",
+		"alert.list.empty":      "هیچ اعلان فعالی وجود ندارد.",
+		"alert.list.item":       "%d. %s (هر%d ثانیه)",
+		"alert.list.digest":     " - خلاصه هر %d دقیقه",
+		"alert.list.paused":     " - متوقف",
+		"alert.pause.error":     "خطا در توقف اعلان.",
+		"alert.pause.done":      "اعلان متوقف شد.",
+		"alert.resume.error":    "خطا در ادامه اعلان.",
+		"alert.resume.done":     "اعلان دوباره فعال شد.",
+		"alert.resume.doneSeen": "اعلان دوباره فعال شد. آگهی‌های منتشر شده در زمان توقف ارسال نمی‌شوند.",
+
+		"button.delete":     "حذف %s",
+		"button.pause":      "توقف",
+		"button.resume":     "ادامه",
+		"button.resumeSeen": "ادامه بدون آگهی‌های قبلی",
+		"button.open":       "مشاهده در دیوار",
+		"button.mute":       "بی‌صدا ۱ ساعت",
+		"button.hide":       "علاقه‌ای ندارم",
+		"button.save":       "ذخیره",
+		"button.track":      "پیگیری قیمت",
+
+		"action.error":           "خطا در انجام درخواست.",
+		"action.mute.done":       "اعلان «%s» به مدت یک ساعت بی‌صدا شد.",
+		"action.hide.done":       "آگهی‌هایی با همین عنوان در همین محله دیگر ارسال نمی‌شوند.",
+		"action.save.done":       "آگهی ذخیره شد.",
+		"action.track.done":      "تغییرات قیمت این آگهی برای شما ارسال می‌شود.",
+		"price.changed":          "تغییر قیمت: %s ← %s",
+		"price.dropped":          "کاهش قیمت: %s ← %s",
+		"price.rose":             "افزایش قیمت: %s ← %s",
+		"deal.below":             "📉 %.0f٪ کمتر از میانه قیمت هر متر این اعلان در %d روز اخیر",
+		"deal.above":             "📈 %.0f٪ بیشتر از میانه قیمت هر متر این اعلان در %d روز اخیر",
+		"deal.median":            "برابر میانه قیمت هر متر این اعلان در %d روز اخیر",
+		"listing.closed":         "آگهی ذخیره شده %s:\n%s\n%s",
+		"listing.summary":        "اولین بار دیده شده: %s، تغییرات قیمت: %d",
+		"listing.closedAt":       "، %s در %s",
+		"listing.status.active":  "فعال",
+		"listing.status.removed": "حذف شده از دیوار",
+		"listing.status.sold":    "فروخته شده",
+		"listing.status.rented":  "اجاره داده شده",
+
+		"stats.error":    "خطا در محاسبه آمار.",
+		"stats.usage":    "برای آمار همه اعلان‌ها /stats و برای آمار یک اعلان شماره آن در /alertList را بفرستید، مثلا: /stats 2",
+		"stats.header":   "📊 %s\n",
+		"stats.empty":    "هنوز آگهی‌ای ثبت نشده است.\n",
+		"stats.daily":    "آگهی‌های جدید هر روز: %s\n",
+		"stats.window":   "\n%d روز اخیر: %d آگهی (%.1f در روز)\n",
+		"stats.price":    "قیمت: میانه %s، کمترین %s، بیشترین %s\n",
+		"stats.perMeter": "قیمت هر متر: میانه %s، کمترین %s، بیشترین %s\n",
+		"stats.deposit":  "ودیعه: میانه %s، کمترین %s، بیشترین %s\n",
+		"stats.rent":     "اجاره: میانه %s، کمترین %s، بیشترین %s\n",
+
+		"chart.error":   "خطا در رسم نمودار.",
+		"chart.usage":   "شماره اعلان در /alertList و در صورت نیاز تعداد روزها (حداکثر %d) را بفرستید، مثلا: /chart 2 یا /chart 2 60",
+		"chart.empty":   "هنوز آگهی کافی با قیمت و متراژ برای «%s» ثبت نشده است.",
+		"chart.caption": "قیمت هر متر «%s» در %d روز اخیر\n%d آگهی، میانه %s تومان\nخط قرمز: میانه هر روز",
+
+		"button.unsave":            "حذف %s",
+		"favorites.error":          "خطا در دریافت آگهی‌های ذخیره شده.",
+		"favorites.empty":          "هیچ آگهی ذخیره شده‌ای وجود ندارد. با دکمه «ذخیره» زیر هر آگهی آن را ذخیره کنید.",
+		"favorites.item":           "%d. %s\n%s - %s\n%s\n%s\n\n",
+		"favorites.exportHint":     "برای دریافت فایل CSV: /favorites export",
+		"favorites.removed":        "آگهی از فهرست ذخیره شده‌ها حذف شد.",
+		"favorites.status.unknown": "وضعیت نامشخص",
+
+		"field.webhook":        "آدرس وبهوک برای ارسال آگهی‌های جدید به صورت JSON، یا off برای حذف",
+		"field.webhookSecret":  "کلید امضای HMAC درخواست‌های وبهوک با حداقل ۱۶ حرف، یا new برای ساخت یک کلید تصادفی",
+		"field.email":          "آدرس ایمیل برای دریافت آگهی‌های جدید، یا off برای حذف",
+		"field.template":       "قالب متن پیام آگهی‌های جدید (text/template) با {{.AlertTitle}}، {{.Title}}، {{.TopDescription}}، {{.MiddleDescription}}، {{.BottomDescription}}، {{.Price}} و {{.URL}}، یا off برای قالب پیش‌فرض",
+		"field.include":        "کلماتی که آگهی باید یکی از آن‌ها را داشته باشد، جدا شده با کاما، یا off برای حذف",
+		"field.exclude":        "کلماتی که آگهی نباید داشته باشد، جدا شده با کاما، یا off برای حذف",
+		"field.regex":          "عبارت باقاعده (regex) که عنوان یا توضیحات آگهی باید با آن تطبیق داشته باشد، یا off برای حذف",
+		"field.rule":           "شرط عددی روی price، deposit، rent و area (به تومان و متر)، مثلا price/area < 80m یا deposit >= 300m && rent <= 10m، یا off برای حذف",
+		"field.reposts":        "tag برای علامت زدن آگهی‌هایی که دوباره منتشر شده‌اند به عنوان «آگهی تکراری»، hide برای ارسال نکردن آن‌ها، یا off برای ارسال به عنوان آگهی جدید",
+		"field.priceChanges":   "on برای ارسال تغییر قیمت آگهی‌های ارسال شده، یک درصد مثل 5 برای ارسال فقط تغییرهای حداقل به این اندازه، یا off",
+		"field.dealPercentile": "یک صدک بین ۱ و ۱۰۰ مثل 25 برای ارسال فقط آگهی‌هایی که قیمت هر متر آن‌ها از این درصد آگهی‌های ۳۰ روز اخیر کمتر یا برابر است، یا off",
+		"field.album":          "on برای ارسال همه عکس‌های آگهی (تا ۱۰ عکس) به صورت آلبوم، یا off برای ارسال فقط عکس اول",
+
+		"edit.alert.invalid":          "شماره اعلان نامعتبر است.",
+		"edit.field.invalid":          "تنظیم انتخاب شده وجود ندارد.",
+		"edit.webhook.invalid":        "آدرس وبهوک باید با http:// یا https:// شروع شود.",
+		"edit.webhook.unresolved":     "آدرس سرور وبهوک پیدا نشد.",
+		"edit.webhook.private":        "وبهوک باید به یک آدرس عمومی در اینترنت اشاره کند، نه به آدرس‌های محلی یا شبکه داخلی.",
+		"edit.webhookSecret.invalid":  "کلید وبهوک باید حداقل %d حرف باشد، یا new بفرستید.",
+		"edit.webhookSecret.set":      "کلید امضای وبهوک: %s\nدرخواست‌های وبهوک با این کلید در هدر X-Divar-Alert-Signature امضا می‌شوند.",
+		"edit.email.notConfigured":    "ارسال ایمیل روی این ربات تنظیم نشده است.",
+		"edit.email.invalid":          "آدرس ایمیل نامعتبر است.",
+		"edit.template.invalid":       "قالب نامعتبر است: %s",
+		"edit.onOff.invalid":          "لطفا on یا off بفرستید.",
+		"edit.regex.invalid":          "عبارت باقاعده نامعتبر است: %s",
+		"edit.rule.invalid":           "شرط نامعتبر است: %s",
+		"edit.reposts.invalid":        "لطفا tag، hide یا off بفرستید.",
+		"edit.priceChanges.invalid":   "لطفا on، off یا یک درصد بین ۰ و ۱۰۰ بفرستید.",
+		"edit.dealPercentile.invalid": "لطفا off یا یک عدد بین ۱ و ۱۰۰ بفرستید.",
+
+		"snooze.usage": "مدت زمان را مشخص کنید، مثلا: /snooze 2h یا /snooze 30m\nبرای لغو: /snooze off",
+		"snooze.error": "خطا در بی‌صدا کردن اعلان‌ها.",
+		"snooze.off":   "اعلان‌ها دوباره فعال شدند.",
+		"snooze.on":    "اعلان‌ها به مدت %s بی‌صدا شدند. آگهی‌های جدید در این مدت ارسال نمی‌شوند.",
+
+		"quiet.usage":  "ساعات سکوت را به وقت تهران مشخص کنید، مثلا: /quiet 23:00-07:00\nبرای لغو: /quiet off",
+		"quiet.error":  "خطا در تنظیم ساعات سکوت.",
+		"quiet.off":    "ساعات سکوت غیرفعال شد.",
+		"quiet.on":     "ساعات سکوت از %s تا %s تنظیم شد. آگهی‌های جدید این بازه پس از پایان آن یکجا ارسال می‌شوند.",
+		"quiet.header": "آگهی‌های جدید در ساعات سکوت:\n\n",
+
+		"digest.header": "خلاصه %d آگهی جدید برای: %s\n\n",
+
+		"email.subject":       "آگهی جدید برای %s: %s",
+		"email.heading":       "آگهی جدید برای: %s",
+		"email.digestSubject": "خلاصه %d آگهی جدید برای %s",
+		"email.link":          "مشاهده در دیوار",
+
+		"caption.default": "پست جدید برای: {{.AlertTitle}}\n\n{{.Title}}\n{{.TopDescription}}\n{{.BottomDescription}}\n{{.MiddleDescription}}\n\n{{.URL}}",
+
+		"dedup.usage":       "برای ارسال یکباره آگهی‌هایی که با چند اعلان تطبیق دارند: /dedup on\nبرای لغو: /dedup off",
+		"dedup.error":       "خطا در تغییر تنظیمات.",
+		"dedup.on":          "آگهی‌هایی که با چند اعلان شما تطبیق دارند فقط یک بار ارسال می‌شوند.",
+		"dedup.off":         "هر اعلان آگهی‌های خود را جداگانه ارسال می‌کند.",
+		"dedup.alsoMatched": "همچنین برای: %s",
+		"list.separator":    "، ",
+		"repost.tag":        "آگهی تکراری - آگهی قبلی: %s",
+
+		"lang.usage": "زبان را انتخاب کنید: /lang fa یا /lang en",
+		"lang.error": "خطا در تغییر زبان.",
+		"lang.done":  "زبان به فارسی تغییر کرد.",
+	},
+	Lang.En: {
+		"default.chooseCommand": "Please choose one of the commands.",
+		"process.error":         "Failed to continue.",
+
+		"step.title":     "Please send the title of the alert:",
+		"step.link":      "Please send the Divar link:",
+		"step.interval":  "How often should it be checked, in seconds?",
+		"step.delivery":  "Send 0 to receive every post right away, or the number of minutes per digest to receive a periodic digest (e.g. 60). To receive the digest as photo albums, add album after the number (e.g. 60 album).",
+		"step.include":   "Only send posts containing one of these words? Separate the words with commas (e.g. new, parking), or send -.",
+		"step.exclude":   "Skip posts containing one of these words? Separate the words with commas (e.g. partnership, full mortgage), or send -.",
+		"step.setEnd":    "The alert was set.",
+		"step.editAlert": "Please send the number of the alert in /alertList:",
+		"step.editField": "Which setting do you want to change?\n",
+		"step.editValue": "Please send the new value:",
+		"step.editEnd":   "The alert was updated.",
+
+		"alert.set.startError":  "Failed to start setting an alert.",
+		"alert.edit.startError": "Failed to start editing an alert.",
+		"alert.delete.error":    "Failed to delete the alert.",
+		"alert.delete.done":     "The alert was deleted.",
+		"alert.list.error":      "Failed to read the alerts.",
+		"alert.list.empty":      "There are no alerts.",
+		"alert.list.item":       "%d. %s (every %d seconds)",
+		"alert.list.digest":     " - digest every %d minutes",
+		"alert.list.paused":     " - paused",
+		"alert.pause.error":     "Failed to pause the alert.",
+		"alert.pause.done":      "The alert was paused.",
+		"alert.resume.error":    "Failed to resume the alert.",
+		"alert.resume.done":     "The alert was resumed.",
+		"alert.resume.doneSeen": "The alert was resumed. Posts published while it was paused will not be sent.",
+
+		"button.delete":     "Delete %s",
+		"button.pause":      "Pause",
+		"button.resume":     "Resume",
+		"button.resumeSeen": "Resume without earlier posts",
+		"button.open":       "Open in Divar",
+		"button.mute":       "Mute 1h",
+		"button.hide":       "Not interested",
+		"button.save":       "Save",
+		"button.track":      "Track price",
+
+		"action.error":           "Failed to do that.",
+		"action.mute.done":       "The alert \"%s\" was muted for an hour.",
+		"action.hide.done":       "Posts with this title in this district will not be sent anymore.",
+		"action.save.done":       "The post was saved.",
+		"action.track.done":      "Price changes of this post will be sent to you.",
+		"price.changed":          "Price changed: %s → %s",
+		"price.dropped":          "Price dropped: %s → %s",
+		"price.rose":             "Price rose: %s → %s",
+		"deal.below":             "📉 %.0f%% below the median price per m² of this alert in the last %d days",
+		"deal.above":             "📈 %.0f%% above the median price per m² of this alert in the last %d days",
+		"deal.median":            "At the median price per m² of this alert in the last %d days",
+		"listing.closed":         "A saved post was %s:\n%s\n%s",
+		"listing.summary":        "First seen: %s, price changes: %d",
+		"listing.closedAt":       ", %s on %s",
+		"listing.status.active":  "active",
+		"listing.status.removed": "removed from Divar",
+		"listing.status.sold":    "sold",
+		"listing.status.rented":  "rented",
+
+		"stats.error":    "Failed to compute the statistics.",
+		"stats.usage":    "Send /stats for all alerts, or the number of an alert in /alertList for one of them, e.g. /stats 2",
+		"stats.header":   "📊 %s\n",
+		"stats.empty":    "No posts were recorded yet.\n",
+		"stats.daily":    "New posts per day: %s\n",
+		"stats.window":   "\nLast %d days: %d posts (%.1f per day)\n",
+		"stats.price":    "Price: median %s, min %s, max %s\n",
+		"stats.perMeter": "Price per m²: median %s, min %s, max %s\n",
+		"stats.deposit":  "Deposit: median %s, min %s, max %s\n",
+		"stats.rent":     "Rent: median %s, min %s, max %s\n",
+
+		"chart.error":   "Failed to draw the chart.",
+		"chart.usage":   "Send the number of an alert in /alertList and optionally a number of days (at most %d), e.g. /chart 2 or /chart 2 60",
+		"chart.empty":   "Not enough posts with a price and an area were recorded for \"%s\" yet.",
+		"chart.caption": "Price per m² of \"%s\" in the last %d days\n%d posts, median %s toman\nRed line: median of each day",
+
+		"button.unsave":            "Remove %s",
+		"favorites.error":          "Failed to read the saved posts.",
+		"favorites.empty":          "There are no saved posts. Save a post with the \"Save\" button below it.",
+		"favorites.item":           "%d. %s\n%s - %s\n%s\n%s\n\n",
+		"favorites.exportHint":     "To get a CSV file: /favorites export",
+		"favorites.removed":        "The post was removed from the saved posts.",
+		"favorites.status.unknown": "unknown status",
+
+		"field.webhook":        "a URL that receives new posts as JSON, or off to remove it",
+		"field.webhookSecret":  "the HMAC key that signs webhook requests, at least 16 characters, or new to generate a random one",
+		"field.email":          "an email address that receives new posts, or off to remove it",
+		"field.template":       "the text/template of new post messages, with {{.AlertTitle}}, {{.Title}}, {{.TopDescription}}, {{.MiddleDescription}}, {{.BottomDescription}}, {{.Price}} and {{.URL}}, or off for the default",
+		"field.include":        "words of which a post must contain one, separated by commas, or off to remove them",
+		"field.exclude":        "words that a post must not contain, separated by commas, or off to remove them",
+		"field.regex":          "a regular expression that the title or descriptions of a post must match, or off to remove it",
+		"field.rule":           "a numeric rule over price, deposit, rent and area (in toman and square meters), e.g. price/area < 80m or deposit >= 300m && rent <= 10m, or off to remove it",
+		"field.reposts":        "tag to mark posts published again as reposts, hide to skip them, or off to send them as new posts",
+		"field.priceChanges":   "on to send price changes of the posts already sent, a percentage such as 5 to send only changes of at least that much, or off",
+		"field.dealPercentile": "a percentile between 1 and 100 such as 25 to send only posts whose price per m² is as low as that percent of the posts of the last 30 days, or off",
+		"field.album":          "on to send all images of a post (up to 10) as an album, or off to send only the first one",
+
+		"edit.alert.invalid":          "Invalid alert number.",
+		"edit.field.invalid":          "There is no such setting.",
+		"edit.webhook.invalid":        "The webhook URL must start with http:// or https://.",
+		"edit.webhook.unresolved":     "The host of the webhook URL cannot be found.",
+		"edit.webhook.private":        "The webhook must point to a public internet address, not to a local or private network.",
+		"edit.webhookSecret.invalid":  "The webhook secret must be at least %d characters long, or send new.",
+		"edit.webhookSecret.set":      "Webhook secret: %s\nWebhook requests are signed with it in the X-Divar-Alert-Signature header.",
+		"edit.email.notConfigured":    "Email is not configured on this bot.",
+		"edit.email.invalid":          "Invalid email address.",
+		"edit.template.invalid":       "Invalid template: %s",
+		"edit.onOff.invalid":          "Please send on or off.",
+		"edit.regex.invalid":          "Invalid regular expression: %s",
+		"edit.rule.invalid":           "Invalid rule: %s",
+		"edit.reposts.invalid":        "Please send tag, hide or off.",
+		"edit.priceChanges.invalid":   "Please send on, off or a percentage between 0 and 100.",
+		"edit.dealPercentile.invalid": "Please send off or a number between 1 and 100.",
+
+		"snooze.usage": "Send a duration, e.g. /snooze 2h or /snooze 30m\nTo unmute: /snooze off",
+		"snooze.error": "Failed to mute the alerts.",
+		"snooze.off":   "The alerts were unmuted.",
+		"snooze.on":    "The alerts were muted for %s. New posts published meanwhile will not be sent.",
+
+		"quiet.usage":  "Send the quiet hours in Tehran time, e.g. /quiet 23:00-07:00\nTo disable: /quiet off",
+		"quiet.error":  "Failed to set the quiet hours.",
+		"quiet.off":    "Quiet hours were disabled.",
+		"quiet.on":     "Quiet hours were set from %s to %s. New posts found meanwhile are sent together when they end.",
+		"quiet.header": "New posts during quiet hours:\n\n",
+
+		"digest.header": "Digest of %d new posts for: %s\n\n",
+
+		"email.subject":       "New post for %s: %s",
+		"email.heading":       "New post for: %s",
+		"email.digestSubject": "Digest of %d new posts for %s",
+		"email.link":          "View on Divar",
+
+		"caption.default": "New post for: {{.AlertTitle}}\n\n{{.Title}}\n{{.TopDescription}}\n{{.BottomDescription}}\n{{.MiddleDescription}}\n\n{{.URL}}",
+
+		"dedup.usage":       "To receive posts matched by several alerts only once: /dedup on\nTo undo: /dedup off",
+		"dedup.error":       "Failed to change the setting.",
+		"dedup.on":          "Posts matched by several of your alerts are sent only once.",
+		"dedup.off":         "Every alert sends its own posts.",
+		"dedup.alsoMatched": "Also matched: %s",
+		"list.separator":    ", ",
+		"repost.tag":        "Repost - earlier post: %s",
+
+		"lang.usage": "Choose a language: /lang fa or /lang en",
+		"lang.error": "Failed to change the language.",
+		"lang.done":  "The language was changed to English.",
+	},
+}
+
+// tr returns a bot message in the given language, falling back to the default language.
+//
+// Parameters:
+//
+//	lang (string): The language, one of Lang.
+//	key (string): The key of the message in the catalog.
+//	args (...any): The arguments of a message with format verbs.
+//
+// Returns:
+//
+//	string: The message.
+func tr(lang string, key string, args ...any) string {
+	text, ok := catalog[lang][key]
+	if !ok {
+		text, ok = catalog[defaultLang][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// chatLang returns the language chosen by a chat.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	string: The language of the chat, the default language if none was chosen or it cannot be read.
+func chatLang(botName string, chatId int64) string {
+	var chat Chat
+	err := db.View(func(txn *badger.Txn) error {
+		var err error
+		chat, err = getChat(txn, botName, chatId)
+		return err
+	})
+	if err != nil || chat.Lang == "" {
+		return defaultLang
+	}
+	return chat.Lang
+}
+
+func handlerLang(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := commandArgs(update.Message.Text)
+	if _, ok := catalog[lang]; !ok {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(chatLang(botName(b), chatId), "lang.usage"),
+		})
+		return
+	}
+
+	_, err := updateChat(botName(b), chatId, func(chat *Chat) {
+		chat.Lang = lang
+	})
+	if err != nil {
+		sugar.Errorw("Failed to change language", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(chatLang(botName(b), chatId), "lang.error"),
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   tr(lang, "lang.done"),
+	})
+}
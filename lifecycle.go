@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listingCheckInterval is how often the saved and tracked posts are looked up on Divar.
+const listingCheckInterval = 6 * time.Hour
+
+// listingHistoryTTL is how long the history of a post that is neither saved nor tracked is kept after it was last listed.
+const listingHistoryTTL = 90 * 24 * time.Hour
+
+// listingCheckWorkers is the number of post pages fetched at once by the listing check.
+const listingCheckWorkers = 3
+
+// ListingEventKind holds the kinds of events in the history of a post.
+//
+// Fields:
+//
+//	FirstSeen (string): An alert found the post.
+//	PriceChanged (string): The price of the post changed.
+//	Removed (string): The post was deleted or expired.
+//	Sold (string): The post was marked as sold.
+//	Rented (string): The post was marked as rented.
+var ListingEventKind = struct {
+	FirstSeen    string
+	PriceChanged string
+	Removed      string
+	Sold         string
+	Rented       string
+}{
+	FirstSeen:    "firstSeen",
+	PriceChanged: "priceChanged",
+	Removed:      divar.ListingStatus.Removed,
+	Sold:         divar.ListingStatus.Sold,
+	Rented:       divar.ListingStatus.Rented,
+}
+
+// listingKey builds the database key under which the history of a post is stored.
+//
+// Parameters:
+//
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the history.
+func listingKey(token string) []byte {
+	return []byte("listing-" + token)
+}
+
+// getListingHistory reads the history of a post.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	ListingHistory: The history of the post.
+//	error: badger.ErrKeyNotFound if the post has no history, another error if it cannot be read, otherwise nil.
+func getListingHistory(txn *badger.Txn, token string) (ListingHistory, error) {
+	var history ListingHistory
+	item, err := txn.Get(listingKey(token))
+	if err != nil {
+		return history, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &history)
+	})
+	return history, err
+}
+
+// saveListingHistory stores the history of a post. The history of a post that is not kept
+// expires listingHistoryTTL after it is saved.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	history (ListingHistory): The history of the post.
+//
+// Returns:
+//
+//	error: An error if the history cannot be saved, otherwise nil.
+func saveListingHistory(txn *badger.Txn, history ListingHistory) error {
+	value, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	entry := badger.NewEntry(listingKey(history.Token), value)
+	if !history.Kept {
+		entry = entry.WithTTL(listingHistoryTTL)
+	}
+	return txn.SetEntry(entry)
+}
+
+// newListingHistory starts the history of a post found now.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	ListingHistory: The history with a single ListingEventKind.FirstSeen event.
+func newListingHistory(post divar.PostWidget) ListingHistory {
+	now := time.Now().Unix()
+	return ListingHistory{
+		Token:      post.Data.Token,
+		Title:      post.Data.Title,
+		Status:     divar.ListingStatus.Active,
+		Events:     []ListingEvent{{Kind: ListingEventKind.FirstSeen, Price: postPrice(post), At: now}},
+		LastSeenAt: now,
+	}
+}
+
+// Price returns the last known price text of the post.
+//
+// Returns:
+//
+//	string: The price text of the latest event that has one, or an empty string.
+func (h ListingHistory) Price() string {
+	for i := len(h.Events) - 1; i >= 0; i-- {
+		if h.Events[i].Price != "" {
+			return h.Events[i].Price
+		}
+	}
+	return ""
+}
+
+// FirstSeenAt returns when an alert first found the post.
+//
+// Returns:
+//
+//	int64: The timestamp of the ListingEventKind.FirstSeen event, or 0 if unknown.
+func (h ListingHistory) FirstSeenAt() int64 {
+	for _, event := range h.Events {
+		if event.Kind == ListingEventKind.FirstSeen {
+			return event.At
+		}
+	}
+	return 0
+}
+
+// recordListing adds a listed post to its history: it starts the history of a new post, and
+// records a change of its price since it was last listed.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	post (divar.PostWidget): The post as currently listed.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func recordListing(txn *badger.Txn, post divar.PostWidget) error {
+	history, err := getListingHistory(txn, post.Data.Token)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return saveListingHistory(txn, newListingHistory(post))
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	changed := false
+	if price := postPrice(post); price != "" && !samePrice(price, history.Price()) {
+		history.Events = append(history.Events, ListingEvent{Kind: ListingEventKind.PriceChanged, Price: price, At: now})
+		changed = true
+	}
+	if history.Status != divar.ListingStatus.Active {
+		// a post found closed was published again
+		history.Status = divar.ListingStatus.Active
+		history.ClosedAt = 0
+		changed = true
+	}
+	// the history is saved at least daily while the post is listed, so it does not expire
+	if !changed && now-history.LastSeenAt < int64((24*time.Hour).Seconds()) {
+		return nil
+	}
+	history.LastSeenAt = now
+	return saveListingHistory(txn, history)
+}
+
+// samePrice reports whether two price texts of a post give the same price. Texts are compared
+// by their amounts, as listings and post pages format them differently, and an amount that
+// only one of the texts gives, such as the rent of a rental listed by its deposit, is ignored.
+// Texts without an amount are compared as they are.
+//
+// Parameters:
+//
+//	price (string): The new price text.
+//	previous (string): The last known price text, empty if unknown.
+//
+// Returns:
+//
+//	bool: True if the price did not change, otherwise false.
+func samePrice(price string, previous string) bool {
+	if previous == "" {
+		return false
+	}
+	current, last := divar.PriceAmounts(price), divar.PriceAmounts(previous)
+	if current.PriceKind == divar.PriceKind.Unknown && last.PriceKind == divar.PriceKind.Unknown {
+		return strings.TrimSpace(price) == strings.TrimSpace(previous)
+	}
+	same := func(a int64, b int64) bool { return a == 0 || b == 0 || a == b }
+	return current.PriceKind == last.PriceKind && same(current.Price, last.Price) && same(current.Deposit, last.Deposit) && same(current.Rent, last.Rent)
+}
+
+// recordDetailPrice records a change of the price shown on the page of a post, so saved and
+// tracked posts that no alert lists anymore still get their price changes in their history.
+//
+// Parameters:
+//
+//	token (string): The token of the post.
+//	detail (divar.PostDetail): The page of the post.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func recordDetailPrice(token string, detail divar.PostDetail) error {
+	price := detail.Price()
+	if divar.PriceAmounts(price).PriceKind == divar.PriceKind.Unknown {
+		return nil
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		history, err := getListingHistory(txn, token)
+		if err != nil {
+			return err
+		}
+		if samePrice(price, history.Price()) {
+			return nil
+		}
+		history.Events = append(history.Events, ListingEvent{Kind: ListingEventKind.PriceChanged, Price: price, At: time.Now().Unix()})
+		return saveListingHistory(txn, history)
+	})
+}
+
+// keepListingHistory keeps the history of a post that was saved or tracked, so it does not expire.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func keepListingHistory(txn *badger.Txn, post divar.PostWidget) error {
+	history, err := getListingHistory(txn, post.Data.Token)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		history, err = newListingHistory(post), nil
+	}
+	if err != nil {
+		return err
+	}
+	history.Kept = true
+	return saveListingHistory(txn, history)
+}
+
+// listingWatchers reads the chats that saved or track each post.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//
+// Returns:
+//
+//	map[string][]Recipient: The bot recipients of each post token, one per chat.
+func listingWatchers(txn *badger.Txn) map[string][]Recipient {
+	watchers := map[string][]Recipient{}
+	for _, prefix := range []string{"favorite-", "tracked-"} {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		for it.Rewind(); it.Valid(); it.Next() {
+			// keys are "<prefix><bot>:<chatId>-<token>"
+			name, chatId, token, ok := parseChatScope(strings.TrimPrefix(string(it.Item().Key()), prefix))
+			if !ok || token == "" {
+				continue
+			}
+			recipient := Recipient{Channel: Channel.Bot, Bot: name, ChatId: chatId}
+			if !slices.Contains(watchers[token], recipient) {
+				watchers[token] = append(watchers[token], recipient)
+			}
+		}
+		it.Close()
+	}
+	return watchers
+}
+
+// closeListing records that a post was removed, sold or rented, and queues a notification to
+// each chat that saved or tracks it. Snoozed chats are not notified, and chats in their quiet
+// hours get it with the posts deferred until the end of the quiet hours.
+//
+// Parameters:
+//
+//	token (string): The token of the post.
+//	status (string): The status of the post, one of divar.ListingStatus other than Active.
+//	recipients ([]Recipient): The chats that saved or track the post.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func closeListing(token string, status string, recipients []Recipient) error {
+	return db.Update(func(txn *badger.Txn) error {
+		history, err := getListingHistory(txn, token)
+		if err != nil {
+			return err
+		}
+		if history.Status == status {
+			return nil
+		}
+		now := time.Now().Unix()
+		history.Status = status
+		history.ClosedAt = now
+		history.Events = append(history.Events, ListingEvent{Kind: status, Price: history.Price(), At: now})
+		if err := saveListingHistory(txn, history); err != nil {
+			return err
+		}
+
+		var post divar.PostWidget
+		item, err := txn.Get(trackedKey(recipients[0].Bot, recipients[0].ChatId, token))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			item, err = txn.Get(favoriteKey(recipients[0].Bot, recipients[0].ChatId, token))
+		}
+		if err == nil {
+			// both Favorite and TrackedPost hold the post as it was last seen
+			var watched struct {
+				Post divar.PostWidget `json:"post"`
+			}
+			if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &watched) }); err == nil {
+				post = watched.Post
+			}
+		}
+		if post.Data.Token == "" {
+			post.Data.Token = token
+			post.Data.Title = history.Title
+		}
+
+		var notified []Recipient
+		for _, recipient := range recipients {
+			chat, err := getChat(txn, recipient.Bot, recipient.ChatId)
+			if err != nil {
+				return err
+			}
+			switch {
+			case chat.SnoozeUntil > now:
+				// the closing stays in the history of the post, shown by /favorites
+				continue
+			case inQuietHours(chat, time.Now()):
+				note := tr(chat.Lang, "listing.status."+status)
+				if _, err := deferPostWithNote(txn, Alert{Bot: recipient.Bot, ChatId: recipient.ChatId}, post, note); err != nil {
+					return err
+				}
+			default:
+				notified = append(notified, recipient)
+			}
+		}
+		if len(notified) == 0 {
+			return nil
+		}
+		_, err = enqueueNotification(txn, PostNotification{Post: post, ListingStatus: status}, notified)
+		return err
+	})
+}
+
+// checkListings looks up the saved and tracked posts that are still active on Divar, records
+// the changes of their prices, and records and notifies the ones that were removed, sold or rented.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the requests.
+func checkListings(ctx context.Context) {
+	var watchers map[string][]Recipient
+	active := map[string]bool{}
+	err := db.Update(func(txn *badger.Txn) error {
+		watchers = listingWatchers(txn)
+		for token := range watchers {
+			history, err := getListingHistory(txn, token)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				// posts saved before histories were recorded
+				history = ListingHistory{Token: token, Status: divar.ListingStatus.Active, Kept: true}
+				if err := saveListingHistory(txn, history); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			}
+			active[token] = history.Status == divar.ListingStatus.Active
+		}
+		return nil
+	})
+	if err != nil {
+		sugar.Errorw("Failed to read watched posts", "error", err)
+		return
+	}
+
+	workers := make(chan struct{}, listingCheckWorkers)
+	var wg sync.WaitGroup
+	for token, recipients := range watchers {
+		if !active[token] {
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			detail, err := divar.GetPost(ctx, token)
+			status := detail.Status()
+			if errors.Is(err, divar.ErrPostNotFound) {
+				status = divar.ListingStatus.Removed
+			} else if err != nil {
+				sugar.Errorw("Failed to check post status", "error", err, "token", token)
+				return
+			}
+			if status == divar.ListingStatus.Active {
+				if err := recordDetailPrice(token, detail); err != nil {
+					sugar.Errorw("Failed to record post price", "error", err, "token", token)
+				}
+				return
+			}
+			sugar.Infow("Post was closed", "token", token, "status", status)
+			if err := closeListing(token, status, recipients); err != nil {
+				sugar.Errorw("Failed to record closed post", "error", err, "token", token)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runListingChecks runs checkListings every listingCheckInterval until the context is done.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context that stops the checks.
+func runListingChecks(ctx context.Context) {
+	ticker := time.NewTicker(listingCheckInterval)
+	defer ticker.Stop()
+	for {
+		checkListings(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listingSummary describes the history of a post in a line.
+//
+// Parameters:
+//
+//	history (ListingHistory): The history of the post.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	string: The summary, e.g. the date the post was first seen and the number of its price changes.
+func listingSummary(history ListingHistory, lang string) string {
+	changes := 0
+	for _, event := range history.Events {
+		if event.Kind == ListingEventKind.PriceChanged {
+			changes++
+		}
+	}
+	summary := tr(lang, "listing.summary", formatDate(history.FirstSeenAt()), changes)
+	if history.ClosedAt > 0 {
+		summary += tr(lang, "listing.closedAt", tr(lang, "listing.status."+history.Status), formatDate(history.ClosedAt))
+	}
+	return summary
+}
+
+// formatDate formats a timestamp as a date in Tehran time.
+//
+// Parameters:
+//
+//	timestamp (int64): The timestamp, 0 if unknown.
+//
+// Returns:
+//
+//	string: The date, e.g. "2025-01-31", or "-" if the timestamp is unknown.
+func formatDate(timestamp int64) string {
+	if timestamp == 0 {
+		return "-"
+	}
+	return time.Unix(timestamp, 0).In(tehran).Format(time.DateOnly)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+	"time"
+)
+
+// detailWithPrice builds the page of a post that shows the given price.
+func detailWithPrice(price string) divar.PostDetail {
+	var widget divar.DetailWidget
+	widget.WidgetType = "UNEXPANDABLE_ROW"
+	widget.Data.Title = "قیمت کل"
+	widget.Data.Value = price
+	var detail divar.PostDetail
+	detail.Sections = append(detail.Sections, struct {
+		SectionName string               `json:"section_name"`
+		Widgets     []divar.DetailWidget `json:"widgets"`
+	}{Widgets: []divar.DetailWidget{widget}})
+	return detail
+}
+
+func TestRecordDetailPrice(t *testing.T) {
+	openTestDB(t)
+	post := testPost("a", "flat")
+	post.Data.MiddleDescriptionText = "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان"
+	err := db.Update(func(txn *badger.Txn) error {
+		return keepListingHistory(txn, post)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same amount written differently is not a change
+	for _, price := range []string{"۲٫۵ میلیارد تومان", "۲٬۴۰۰٬۰۰۰٬۰۰۰ تومان", "توافقی"} {
+		if err := recordDetailPrice("a", detailWithPrice(price)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var history ListingHistory
+	err = db.View(func(txn *badger.Txn) error {
+		history, err = getListingHistory(txn, "a")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Events) != 2 || history.Events[1].Kind != ListingEventKind.PriceChanged || history.Price() != "۲٬۴۰۰٬۰۰۰٬۰۰۰ تومان" {
+		t.Errorf("history events = %+v, want the first sighting and one price change", history.Events)
+	}
+}
+
+// detailWithRows builds the page of a post with the given rows, as title and value pairs.
+func detailWithRows(rows ...[2]string) divar.PostDetail {
+	detail := detailWithPrice("")
+	detail.Sections[0].Widgets = nil
+	for _, row := range rows {
+		var widget divar.DetailWidget
+		widget.WidgetType = "UNEXPANDABLE_ROW"
+		widget.Data.Title = row[0]
+		widget.Data.Value = row[1]
+		detail.Sections[0].Widgets = append(detail.Sections[0].Widgets, widget)
+	}
+	return detail
+}
+
+func TestListingAndPagePricesAgree(t *testing.T) {
+	sale := testPost("sale", "flat")
+	sale.Data.MiddleDescriptionText = "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان"
+	rental := testPost("rental", "flat")
+	rental.Data.TopDescriptionText = "ودیعه: ۲۰۰ میلیون تومان"
+	rental.Data.MiddleDescriptionText = "اجارهٔ ماهانه: ۱۰ میلیون تومان"
+	depositOnly := testPost("deposit", "flat")
+	depositOnly.Data.MiddleDescriptionText = "ودیعه ۲۰۰ میلیون، اجاره ۱۰ میلیون تومان"
+	tests := []struct {
+		post   divar.PostWidget
+		detail divar.PostDetail
+	}{
+		{sale, detailWithRows([2]string{"قیمت کل", "۲٬۵۰۰٬۰۰۰٬۰۰۰ تومان"})},
+		{rental, detailWithRows([2]string{"ودیعه", "۲۰۰٬۰۰۰٬۰۰۰ تومان"}, [2]string{"اجارهٔ ماهانه", "۱۰٬۰۰۰٬۰۰۰ تومان"})},
+		{depositOnly, detailWithRows([2]string{"ودیعه", "۲۰۰ میلیون تومان"}, [2]string{"اجارهٔ ماهانه", "۱۰ میلیون تومان"})},
+	}
+	for _, test := range tests {
+		openTestDB(t)
+		token := test.post.Data.Token
+		err := db.Update(func(txn *badger.Txn) error {
+			return recordListing(txn, test.post)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the page, the listing and the page again all show the same price
+		for i := 0; i < 2; i++ {
+			if err := recordDetailPrice(token, test.detail); err != nil {
+				t.Fatal(err)
+			}
+			err = db.Update(func(txn *badger.Txn) error {
+				return recordListing(txn, test.post)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var history ListingHistory
+		err = db.View(func(txn *badger.Txn) error {
+			history, err = getListingHistory(txn, token)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Events) != 1 {
+			t.Errorf("%s: history events = %+v, want only the first sighting", token, history.Events)
+		}
+	}
+}
+
+func TestCloseListingWhileSnoozedOrQuiet(t *testing.T) {
+	openTestDB(t)
+	post := testPost("a", "flat")
+	err := db.Update(func(txn *badger.Txn) error {
+		return keepListingHistory(txn, post)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := updateChat("telegram", 1, func(chat *Chat) { chat.SnoozeUntil = now.Add(time.Hour).Unix() }); err != nil {
+		t.Fatal(err)
+	}
+	_, err = updateChat("telegram", 2, func(chat *Chat) {
+		chat.QuietStart = now.In(tehran).Add(-time.Hour).Format("15:04")
+		chat.QuietEnd = now.In(tehran).Add(time.Hour).Format("15:04")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recipients []Recipient
+	for _, chatId := range []int64{1, 2, 3} {
+		recipients = append(recipients, Recipient{Channel: Channel.Bot, Bot: "telegram", ChatId: chatId})
+	}
+	if err := closeListing("a", divar.ListingStatus.Sold, recipients); err != nil {
+		t.Fatal(err)
+	}
+
+	outbox, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].Recipient.ChatId != 3 {
+		t.Errorf("outbox = %+v, want only the chat that is neither snoozed nor quiet", outbox)
+	}
+	for chatId, want := range map[int64]int{1: 0, 2: 1, 3: 0} {
+		deferred, err := readQueue("deferred-" + chatScope("telegram", chatId) + "-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deferred) != want {
+			t.Errorf("chat %d has %d deferred posts, want %d", chatId, len(deferred), want)
+		}
+	}
+}
@@ -11,10 +11,13 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/mrmohebi/divar-alert/divar"
 	"go.uber.org/zap"
+	"net/http"
 	"os"
 	"os/signal"
 	"slices"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -23,8 +26,6 @@ var sugar *zap.SugaredLogger
 
 var db *badger.DB
 
-var b *bot.Bot
-
 func main() {
 	logger, _ = zap.NewProduction()
 
@@ -36,15 +37,20 @@ func main() {
 		sugar.Warn("Error loading .env file")
 	}
 
-	TelegramToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	TelegramApiUrl := os.Getenv("TELEGRAM_API_URL")
+	BotConfigs, err := loadBotConfigs()
 	DBPath := os.Getenv("DB_PATH")
+	WebhookConfig, webhookErr := loadWebhookServerConfig()
+	if webhookErr != nil {
+		sugar.Fatal(webhookErr)
+	}
 
-	if TelegramApiUrl == "" || TelegramToken == "" || DBPath == "" {
-		sugar.Fatal("TELEGRAM_API_URL and TELEGRAM_BOT_TOKEN and DB_PATH must be set in .env file")
+	if err != nil || DBPath == "" {
+		sugar.Fatal("bot settings and DB_PATH must be set in .env file: ", err)
 	} else {
-		sugar.Infof("TELEGRAM_API_URL: %s", TelegramApiUrl)
-		sugar.Infof("TELEGRAM_BOT_TOKEN: %s", TelegramToken)
+		for _, config := range BotConfigs {
+			sugar.Infof("BOT %s API_URL: %s", config.Name, config.ApiUrl)
+			sugar.Infof("BOT %s TOKEN: %s", config.Name, config.Token)
+		}
 		sugar.Infof("DB_PATH: %s", DBPath)
 	}
 
@@ -55,32 +61,113 @@ func main() {
 	}
 	defer db.Close()
 
-	// ------------------ init and config bot -----------------
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	// ------------------ init and config bots -----------------
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	opts := []bot.Option{
-		bot.WithServerURL(TelegramApiUrl),
-		bot.WithDefaultHandler(handlerDefault),
-		bot.WithCallbackQueryDataHandler("delete_alert-", bot.MatchTypePrefix, handlerCallbackDeleteAlert),
+	for _, config := range BotConfigs {
+		opts := []bot.Option{
+			bot.WithServerURL(config.ApiUrl),
+			bot.WithWebhookSecretToken(webhookSecret(WebhookConfig)),
+			bot.WithDefaultHandler(handlerDefault),
+			bot.WithCallbackQueryDataHandler("delete_alert-", bot.MatchTypePrefix, handlerCallbackDeleteAlert),
+			bot.WithCallbackQueryDataHandler("pause_alert-", bot.MatchTypePrefix, handlerCallbackPauseAlert),
+			bot.WithCallbackQueryDataHandler("resume_alert-", bot.MatchTypePrefix, handlerCallbackResumeAlert),
+			bot.WithCallbackQueryDataHandler("resume_alert_seen-", bot.MatchTypePrefix, handlerCallbackResumeAlertMarkSeen),
+			bot.WithCallbackQueryDataHandler("mute_alert-", bot.MatchTypePrefix, handlerCallbackMuteAlert),
+			bot.WithCallbackQueryDataHandler("hide_post-", bot.MatchTypePrefix, handlerCallbackHidePost),
+			bot.WithCallbackQueryDataHandler("save_post-", bot.MatchTypePrefix, handlerCallbackSavePost),
+			bot.WithCallbackQueryDataHandler("track_price-", bot.MatchTypePrefix, handlerCallbackTrackPrice),
+			bot.WithCallbackQueryDataHandler("unsave_post-", bot.MatchTypePrefix, handlerCallbackUnsavePost),
+		}
+
+		b, err := bot.New(config.Token, opts...)
+		if err != nil {
+			sugar.Fatal(err)
+		}
+
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/alertSet", bot.MatchTypeExact, handlerAlertSet)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/alertList", bot.MatchTypeExact, handlerAlertList)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/alertEdit", bot.MatchTypeExact, handlerAlertEdit)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/snooze", bot.MatchTypePrefix, handlerSnooze)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/quiet", bot.MatchTypePrefix, handlerQuiet)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/lang", bot.MatchTypePrefix, handlerLang)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/favorites", bot.MatchTypePrefix, handlerFavorites)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/dedup", bot.MatchTypePrefix, handlerDedup)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/stats", bot.MatchTypePrefix, handlerStats)
+		b.RegisterHandler(bot.HandlerTypeMessageText, "/chart", bot.MatchTypePrefix, handlerChart)
+
+		bots = append(bots, &botInstance{
+			Name:    config.Name,
+			Bot:     b,
+			Limiter: newSendLimiter(globalSendRate, chatSendRate),
+		})
+	}
+
+	if err := migrateSchema(bots[0].Name); err != nil {
+		sugar.Fatal(err)
 	}
 
-	b, err = bot.New(TelegramToken, opts...)
+	notifiers[Channel.Bot] = &BotNotifier{Client: &http.Client{Timeout: 30 * time.Second}}
+	notifiers[Channel.Webhook] = &WebhookNotifier{Client: newWebhookClient()}
+	emailNotifier, err := loadEmailNotifier()
 	if err != nil {
 		sugar.Fatal(err)
 	}
+	if emailNotifier != nil {
+		sugar.Infof("SMTP_HOST: %s", emailNotifier.Host)
+		notifiers[Channel.Email] = emailNotifier
+	}
 
 	go checkForNewAlert()
+	go runOutbox(ctx)
+	go runListingChecks(ctx)
+
+	if WebhookConfig != nil {
+		if err := runWebhookServer(ctx, WebhookConfig); err != nil {
+			sugar.Fatal(err)
+		}
+		return
+	}
 
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/alertSet", bot.MatchTypeExact, handlerAlertSet)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/alertList", bot.MatchTypeExact, handlerAlertList)
+	// a webhook left over from webhook mode would make long polling fail
+	deleteWebhooks(ctx)
 
-	b.Start(ctx)
+	var wg sync.WaitGroup
+	for _, instance := range bots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance.Bot.Start(ctx)
+		}()
+	}
+	wg.Wait()
 }
 
+// searchFunc looks up the posts listed by the search link of an alert.
+type searchFunc func(link string) (divar.SearchRes, error)
+
 func checkForNewAlert() {
+	for {
+		checkAlerts(divar.Search, notifiers)
+		time.Sleep(1 * time.Second)
+		sugar.Infow("Finished checking for new alerts")
+	}
+}
+
+// checkAlerts runs one pass of the scheduler: every due alert is searched, its new posts
+// are queued for delivery, and the deferred posts and digests that are due are sent.
+// Each alert is checked in its own transaction, so the posts of one alert neither wait
+// for the searches of the others nor grow a single transaction past its limits.
+//
+// Parameters:
+//
+//	search (searchFunc): The function that looks up the posts of an alert.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel, posts are not queued for channels without one.
+func checkAlerts(search searchFunc, notifiers map[string]Notifier) {
 	// read all alerts from the database
-	err := db.Update(func(txn *badger.Txn) error {
+	var alerts []Alert
+	err := db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.Prefix = []byte("alert-")
 		it := txn.NewIterator(opts)
@@ -96,92 +183,201 @@ func checkForNewAlert() {
 				sugar.Errorw("Failed to unmarshal alert", "error", err)
 				continue
 			}
+			alerts = append(alerts, alert)
+		}
+		return nil
+	})
+	if err != nil {
+		sugar.Errorw("Failed to read alerts from database", "error", err)
+		return
+	}
 
-			// check if alert is due for checking
-			if alert.LastTimeChecked+int64(alert.Interval) > time.Now().Unix() {
-				//sugar.Infow("Skipping alert check, not due yet", "alert", alert.Title)
-				continue
-			}
+	for _, alert := range alerts {
+		if alert.Paused {
+			continue
+		}
 
-			sugar.Infow("Checking for new posts for alert", "alert", alert.Title)
+		// check if alert is due for checking
+		if alert.LastTimeChecked+int64(alert.Interval) > time.Now().Unix() {
+			//sugar.Infow("Skipping alert check, not due yet", "alert", alert.Title)
+			continue
+		}
 
-			res, err := divar.Search(alert.Link)
+		if _, ok := findBot(alert.Bot); !ok {
+			sugar.Errorw("Skipping alert of a bot that is not configured", "bot", alert.Bot, "alert", alert.Title)
+			continue
+		}
 
-			if err != nil {
-				sugar.Errorw("Failed to search for alert", "error", err, "alert", alert.Title)
-				continue
-			}
-			// check posts are already in database, if they are not, save them and send message to user
-			if len(res.ListWidgets) > 0 {
-				slices.Reverse(res.ListWidgets)
-				for _, post := range res.ListWidgets {
-					// check if post is already in database
-					key := fmt.Sprintf("post-%s-%d", post.Data.Token, alert.Id)
-					_, err := txn.Get([]byte(key))
-					if errors.Is(err, badger.ErrKeyNotFound) {
-						// post not found, save it to database
-						value, err := json.Marshal(post)
-						if err != nil {
-							sugar.Errorw("Failed to marshal post", "error", err, "post", post.Data.Title)
-							continue
-						}
-						err = txn.Set([]byte(key), value)
-						if err != nil {
-							sugar.Errorw("Failed to save post to database", "error", err, "post", post.Data.Title)
-							continue
-						}
-
-						text := "پست جدید برای: " + alert.Title + "\n\n"
-						text += post.Data.Title + "\n"
-						text += post.Data.TopDescriptionText + "\n"
-						text += post.Data.BottomDescriptionText + "\n"
-						text += post.Data.MiddleDescriptionText + "\n\n"
-						text += fmt.Sprintf("https://divar.ir/v/%s", post.Data.Token)
-
-						// send message to user
-						b.SendPhoto(context.Background(), &bot.SendPhotoParams{
-							ChatID:  alert.ChatId,
-							Photo:   &models.InputFileString{Data: post.Data.ImageURL},
-							Caption: text,
-						})
-					} else if err != nil {
-						sugar.Errorw("Failed to get post from database", "error", err, "post", post.Data.Title)
-					}
-				}
-			} else {
-				sugar.Infow("No new posts found for alert", "alert", alert.Title)
-			}
+		sugar.Infow("Checking for new posts for alert", "alert", alert.Title)
 
-			// update last time checked
-			alert.LastTimeChecked = time.Now().Unix()
-			key := fmt.Sprintf("alert-%d-%d", alert.ChatId, alert.Id)
-			value, err := json.Marshal(alert)
-			if err != nil {
-				sugar.Errorw("Failed to marshal alert", "error", err, "alert", alert.Title)
-				return err
+		res, err := search(alert.Link)
+		if err != nil {
+			sugar.Errorw("Failed to search for alert", "error", err, "alert", alert.Title)
+			continue
+		}
+
+		err = db.Update(func(txn *badger.Txn) error {
+			return checkAlertPosts(txn, alert, res.ListWidgets, notifiers)
+		})
+		if err != nil {
+			sugar.Errorw("Failed to check posts for alert", "error", err, "alert", alert.Title)
+		}
+	}
+
+	deliverDeferredPosts()
+	deliverDigests(notifiers)
+}
+
+// checkAlertPosts records the posts found by the search of an alert and queues the new
+// ones for delivery, then records that the alert was checked.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert as it was read before the search.
+//	posts ([]divar.PostWidget): The posts found by the search, newest first.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel, posts are not queued for channels without one.
+//
+// Returns:
+//
+//	error: An error if the alert cannot be read or saved, otherwise nil.
+func checkAlertPosts(txn *badger.Txn, alert Alert, posts []divar.PostWidget, notifiers map[string]Notifier) error {
+	// the alert may have been changed or deleted during the search
+	alert, err := getAlert(txn, alert.Bot, alert.ChatId, alert.Id)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	chat, err := getChat(txn, alert.Bot, alert.ChatId)
+	if err != nil {
+		return err
+	}
+	// posts are still recorded as seen while muted, so they don't flood the chat afterwards
+	muted := isMuted(alert, chat, time.Now())
+	quiet := inQuietHours(chat, time.Now())
+
+	// posts are scored against the posts of earlier checks
+	market, err := loadAlertMarket(txn, alert)
+	if err != nil {
+		sugar.Errorw("Failed to read recent prices", "error", err, "alert", alert.Title)
+	}
+
+	// check posts are already in database, if they are not, save them and send message to user
+	if len(posts) > 0 {
+		slices.Reverse(posts)
+		for _, post := range posts {
+			if err := recordListing(txn, post); err != nil {
+				sugar.Errorw("Failed to record post history", "error", err, "post", post.Data.Title)
 			}
-			err = txn.Set([]byte(key), value)
-			if err != nil {
-				sugar.Errorw("Failed to save alert to database", "error", err, "alert", alert.Title)
-				return err
+			if err := recordPrice(txn, alert, post); err != nil {
+				sugar.Errorw("Failed to record post price", "error", err, "post", post.Data.Title)
 			}
-
-			if err != nil {
-				sugar.Errorw("Failed to update last time checked for alert", "error", err, "alert", alert)
-				continue
+			if err := checkTrackedPrice(txn, alert, post, muted, quiet); err != nil {
+				sugar.Errorw("Failed to check tracked price", "error", err, "post", post.Data.Title)
 			}
 
+			// check if post is already in database
+			key := fmt.Sprintf("post-%s-%d", post.Data.Token, alert.Id)
+			seenItem, err := txn.Get([]byte(key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				// post not found, queue it and save it to database with whether the chat got it
+				sent := queueNewPost(txn, alert, chat, market, post, muted, quiet, notifiers)
+				if err := saveSeenPost(txn, []byte(key), SeenPost{PostWidget: post, Skipped: !sent}); err != nil {
+					sugar.Errorw("Failed to save post to database", "error", err, "post", post.Data.Title)
+				}
+			} else if err != nil {
+				sugar.Errorw("Failed to get post from database", "error", err, "post", post.Data.Title)
+			} else if alert.PriceChanges && !muted {
+				if err := checkSeenPrice(txn, alert, market, seenItem, post, quiet); err != nil {
+					sugar.Errorw("Failed to check price change", "error", err, "post", post.Data.Title)
+				}
+			}
 		}
-		return nil
-	})
+	} else {
+		sugar.Infow("No new posts found for alert", "alert", alert.Title)
+	}
+
+	// update last time checked
+	alert.LastTimeChecked = time.Now().Unix()
+	alert.MarkSeenOnce = false
+	return saveAlert(txn, alert)
+}
+
+// queueNewPost queues a post an alert found for the first time for delivery to the recipients
+// of the alert, unless the alert is muted or the post is filtered out, hidden, a hidden repost,
+// or was already sent to the chat by another alert.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that found the post.
+//	chat (Chat): The settings of the chat of the alert.
+//	market (alertMarket): The recent prices of the alert, to score the post against.
+//	post (divar.PostWidget): The new post.
+//	muted (bool): Whether the alert or the chat is muted.
+//	quiet (bool): Whether the chat is in its quiet hours.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel.
+//
+// Returns:
+//
+//	bool: True if the post was sent or queued for the chat, otherwise false.
+func queueNewPost(txn *badger.Txn, alert Alert, chat Chat, market alertMarket, post divar.PostWidget, muted bool, quiet bool, notifiers map[string]Notifier) bool {
+	deal := market.Score(post)
+	if muted || isHidden(txn, alert.Bot, alert.ChatId, post) || !matchesFilters(alert, post) || !matchesRule(alert, post) || !matchesDeal(alert, market, deal) {
+		return false
+	}
+	repostOf, err := findRepost(txn, alert, post)
 	if err != nil {
-		sugar.Errorw("Failed to read alerts from database", "error", err)
-		return
+		sugar.Errorw("Failed to check repost", "error", err, "post", post.Data.Title)
+	}
+	if repostOf != "" && alert.Reposts == RepostMode.Hide {
+		return false
+	}
+	duplicate := false
+	if chat.Dedup {
+		if duplicate, err = dedupPost(txn, alert, post); err != nil {
+			sugar.Errorw("Failed to check duplicate post", "error", err, "post", post.Data.Title)
+		}
+	}
+
+	recipients := alertRecipients(alert, notifiers)
+	queueKey := ""
+	if duplicate {
+		// the chat already got the post from another alert
+		recipients = withoutChannel(recipients, Channel.Bot)
+	} else if alert.DigestPeriod > 0 {
+		// the chat and the email get the post later in a digest
+		if queueKey, err = queueDigestPost(txn, alert, post); err != nil {
+			sugar.Errorw("Failed to add post to digest", "error", err, "post", post.Data.Title)
+		}
+		recipients = withoutChannel(withoutChannel(recipients, Channel.Bot), Channel.Email)
+	} else if quiet {
+		// the chat gets the post when quiet hours end, other channels get it right away
+		if queueKey, err = deferPost(txn, alert, post); err != nil {
+			sugar.Errorw("Failed to defer post", "error", err, "post", post.Data.Title)
+		}
+		recipients = withoutChannel(recipients, Channel.Bot)
 	}
 
-	time.Sleep(1 * time.Second)
-	sugar.Infow("Finished checking for new alerts")
-	checkForNewAlert()
+	// queue messages to recipients, the outbox sender delivers them
+	keys, err := enqueueNotification(txn, PostNotification{Alert: alert, Post: post, RepostOf: repostOf, Deal: deal}, recipients)
+	if err != nil {
+		sugar.Errorw("Failed to queue notification", "error", err, "post", post.Data.Title)
+	}
+	if chat.Dedup && !duplicate {
+		if err := recordDedup(txn, alert, post, recipients, keys, queueKey); err != nil {
+			sugar.Errorw("Failed to record post for dedup", "error", err, "post", post.Data.Title)
+		}
+	}
+	if alert.Reposts != RepostMode.Off {
+		if err := recordRepost(txn, alert, post); err != nil {
+			sugar.Errorw("Failed to record post fingerprints", "error", err, "post", post.Data.Title)
+		}
+	}
+	return !duplicate
 }
 
 func handlerCallbackDeleteAlert(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -190,6 +386,7 @@ func handlerCallbackDeleteAlert(ctx context.Context, b *bot.Bot, update *models.
 		ShowAlert:       false,
 	})
 
+	lang := chatLang(botName(b), update.CallbackQuery.Message.Message.Chat.ID)
 	alertIdStr := update.CallbackQuery.Data[len("delete_alert-"):]
 
 	// delete alert from database
@@ -198,12 +395,12 @@ func handlerCallbackDeleteAlert(ctx context.Context, b *bot.Bot, update *models.
 		sugar.Errorw("Failed to parse alert ID", "error", err)
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.CallbackQuery.Message.Message.Chat.ID,
-			Text:   "خطا در حذف اعلان.",
+			Text:   tr(lang, "alert.delete.error"),
 		})
 		return
 	}
+	key := alertKey(botName(b), update.CallbackQuery.Message.Message.Chat.ID, alertId)
 	err = db.Update(func(txn *badger.Txn) error {
-		key := []byte(fmt.Sprintf("alert-%d-%d", update.CallbackQuery.Message.Message.Chat.ID, alertId))
 		println(string(key))
 		return txn.Delete(key)
 	})
@@ -211,25 +408,28 @@ func handlerCallbackDeleteAlert(ctx context.Context, b *bot.Bot, update *models.
 		sugar.Errorw("Failed to delete alert", "error", err)
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.CallbackQuery.Message.Message.Chat.ID,
-			Text:   "خطا در حذف اعلان.",
+			Text:   tr(lang, "alert.delete.error"),
 		})
 		return
 	}
+	compiledRegexes.Delete(string(key))
+	compiledRules.Delete(string(key))
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.CallbackQuery.Message.Message.Chat.ID,
-		Text:   "اعلان با موفقیت حذف شد.",
+		Text:   tr(lang, "alert.delete.done"),
 	})
 
 }
 
 func handlerAlertSet(ctx context.Context, b *bot.Bot, update *models.Update) {
-	p, err := ProcessStart(ProcessKey.SetAlert, update.Message.Chat.ID, db)
+	lang := chatLang(botName(b), update.Message.Chat.ID)
+	p, err := ProcessStart(ProcessKey.SetAlert, update.Message.Chat.ID, botName(b), lang, db)
 	if err != nil {
 		sugar.Errorw("Failed to start alert process", "error", err)
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "خطا در شروع فرآیند تنظیم هشدار.",
+			Text:   tr(lang, "alert.set.startError"),
 		})
 		return
 	}
@@ -241,32 +441,13 @@ func handlerAlertSet(ctx context.Context, b *bot.Bot, update *models.Update) {
 }
 
 func handlerAlertList(ctx context.Context, b *bot.Bot, update *models.Update) {
-
-	var alerts []Alert
-	err := db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.Prefix = []byte("alert-" + strconv.FormatInt(update.Message.Chat.ID, 10))
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			var alert Alert
-			err := item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &alert)
-			})
-			if err != nil {
-				return err
-			}
-			alerts = append(alerts, alert)
-		}
-		return nil
-	})
+	lang := chatLang(botName(b), update.Message.Chat.ID)
+	alerts, err := listAlerts(botName(b), update.Message.Chat.ID)
 	if err != nil {
 		sugar.Errorw("Failed to list alerts", "error", err)
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "خطا در دریافت اعلان‌ها.",
+			Text:   tr(lang, "alert.list.error"),
 		})
 		return
 	}
@@ -274,7 +455,7 @@ func handlerAlertList(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if len(alerts) == 0 {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "هیچ اعلان فعالی وجود ندارد.",
+			Text:   tr(lang, "alert.list.empty"),
 		})
 		return
 	}
@@ -282,7 +463,13 @@ func handlerAlertList(ctx context.Context, b *bot.Bot, update *models.Update) {
 	var response string
 
 	for i, alert := range alerts {
-		response += strconv.Itoa(i+1) + ". " + alert.Title + " (هر" + strconv.Itoa(alert.Interval) + " ثانیه)"
+		response += tr(lang, "alert.list.item", i+1, alert.Title, alert.Interval)
+		if alert.DigestPeriod > 0 {
+			response += tr(lang, "alert.list.digest", alert.DigestPeriod/60)
+		}
+		if alert.Paused {
+			response += tr(lang, "alert.list.paused")
+		}
 		if i != len(alerts)-1 {
 			response += "\n"
 		}
@@ -290,12 +477,28 @@ func handlerAlertList(ctx context.Context, b *bot.Bot, update *models.Update) {
 
 	var inlineKeyboardButtons [][]models.InlineKeyboardButton
 	for _, alert := range alerts {
-		inlineKeyboardButtons = append(inlineKeyboardButtons, []models.InlineKeyboardButton{
+		alertId := strconv.FormatInt(alert.Id, 10)
+		row := []models.InlineKeyboardButton{
 			{
-				Text:         "حذف " + alert.Title,
-				CallbackData: "delete_alert-" + strconv.FormatInt(alert.Id, 10),
+				Text:         tr(lang, "button.delete", alert.Title),
+				CallbackData: "delete_alert-" + alertId,
 			},
-		})
+		}
+		if alert.Paused {
+			row = append(row, models.InlineKeyboardButton{
+				Text:         tr(lang, "button.resume"),
+				CallbackData: "resume_alert-" + alertId,
+			}, models.InlineKeyboardButton{
+				Text:         tr(lang, "button.resumeSeen"),
+				CallbackData: "resume_alert_seen-" + alertId,
+			})
+		} else {
+			row = append(row, models.InlineKeyboardButton{
+				Text:         tr(lang, "button.pause"),
+				CallbackData: "pause_alert-" + alertId,
+			})
+		}
+		inlineKeyboardButtons = append(inlineKeyboardButtons, row)
 	}
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
@@ -306,22 +509,31 @@ func handlerAlertList(ctx context.Context, b *bot.Bot, update *models.Update) {
 }
 
 func handlerDefault(ctx context.Context, b *bot.Bot, update *models.Update) {
-	key, p, err := CurrentProcess(update.Message.Chat.ID, db)
+	lang := chatLang(botName(b), update.Message.Chat.ID)
+	key, p, err := CurrentProcess(update.Message.Chat.ID, botName(b), db)
 	if err != nil {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "لطفا یکی از دستورات را انتخاب کنید.",
+			Text:   tr(lang, "default.chooseCommand"),
 		})
 		return
 	}
 
 	if key != "" {
 		p, err = ProcessGoNextStep(p, update.Message.Text, db)
+		var inputErr *ProcessInputError
+		if errors.As(err, &inputErr) {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   tr(lang, inputErr.Key, inputErr.Args...),
+			})
+			return
+		}
 		if err != nil {
 			sugar.Errorw("Failed to go to next step", "error", err)
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID: update.Message.Chat.ID,
-				Text:   "خطا در ادامه فرآیند.",
+				Text:   tr(lang, "process.error"),
 			})
 			return
 		}
@@ -333,7 +545,7 @@ func handlerDefault(ctx context.Context, b *bot.Bot, update *models.Update) {
 	} else {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "لطفا یکی از دستورات را انتخاب کنید.",
+			Text:   tr(lang, "default.chooseCommand"),
 		})
 		return
 	}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"testing"
+)
+
+// recordingNotifier records the notifications it is asked to send.
+type recordingNotifier struct {
+	sent []PostNotification
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, recipient Recipient, notification PostNotification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// testPost builds a listed post with the given token and title.
+func testPost(token string, title string) divar.PostWidget {
+	var post divar.PostWidget
+	post.Data.Token = token
+	post.Data.Title = title
+	return post
+}
+
+// saveTestAlert stores an alert that is due for checking.
+func saveTestAlert(t *testing.T, alert Alert) {
+	t.Helper()
+	err := db.Update(func(txn *badger.Txn) error {
+		return saveAlert(txn, alert)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckAlertsNotifiesNewPosts(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link"})
+
+	var searched []string
+	listed := []divar.PostWidget{testPost("b", "newer"), testPost("a", "older")}
+	search := func(link string) (divar.SearchRes, error) {
+		searched = append(searched, link)
+		return divar.SearchRes{ListWidgets: slices.Clone(listed)}, nil
+	}
+	recorder := &recordingNotifier{}
+	testNotifiers := map[string]Notifier{Channel.Bot: recorder}
+
+	checkAlerts(search, testNotifiers)
+	deliverOutbox(context.Background(), testNotifiers)
+
+	if !slices.Equal(searched, []string{"flats-link"}) {
+		t.Errorf("searched %v, want the link of the alert", searched)
+	}
+	var tokens []string
+	for _, notification := range recorder.sent {
+		tokens = append(tokens, notification.Post.Data.Token)
+		if notification.Alert.Id != 1 {
+			t.Errorf("notification of alert %d, want alert 1", notification.Alert.Id)
+		}
+	}
+	// posts are listed newest first and sent oldest first
+	if !slices.Equal(tokens, []string{"a", "b"}) {
+		t.Errorf("sent posts %v, want [a b]", tokens)
+	}
+
+	// a second pass finds the same posts, which are already seen
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link"})
+	recorder.sent = nil
+	checkAlerts(search, testNotifiers)
+	deliverOutbox(context.Background(), testNotifiers)
+	if len(recorder.sent) != 0 {
+		t.Errorf("second pass sent %d posts, want none", len(recorder.sent))
+	}
+}
+
+func TestCheckAlertsSkipsChannelsWithoutNotifier(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", Email: "a@example.com"})
+
+	search := func(link string) (divar.SearchRes, error) {
+		return divar.SearchRes{ListWidgets: []divar.PostWidget{testPost("a", "flat")}}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+
+	items, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Recipient.Channel != Channel.Bot {
+		t.Errorf("outbox holds %+v, want only the bot notification", items)
+	}
+}
+
+func TestCheckAlertsChecksEachAlertOnItsOwn(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "deleted", Link: "deleted-link"})
+	saveTestAlert(t, Alert{Id: 2, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link"})
+
+	search := func(link string) (divar.SearchRes, error) {
+		if link == "deleted-link" {
+			// the chat deletes the alert while it is being searched
+			err := db.Update(func(txn *badger.Txn) error {
+				return txn.Delete(alertKey("telegram", 10, 1))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return divar.SearchRes{ListWidgets: []divar.PostWidget{testPost(link, "flat")}}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+
+	items, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Alert.Id != 2 {
+		t.Errorf("outbox holds %+v, want only the post of the remaining alert", items)
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		if _, err := getAlert(txn, "telegram", 10, 1); !errors.Is(err, badger.ErrKeyNotFound) {
+			t.Errorf("the deleted alert was saved again: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
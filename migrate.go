@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"strconv"
+	"strings"
+)
+
+// schemaVersionKey is the key of the version of the stored data, which tells the migrations already done.
+var schemaVersionKey = []byte("schema-version")
+
+// schemaVersion is the version of the stored data written by this build.
+const schemaVersion = 1
+
+// legacyProcessSuffixes are the suffixes of the keys of a process of a chat written before
+// keys held the name of their bot.
+var legacyProcessSuffixes = []string{"-CURRENT_PROCESS", "-" + ProcessKey.SetAlert}
+
+// isLegacyChatKey reports whether a key was written before per-chat keys held the name of
+// their bot, i.e. its chat ID directly follows the prefix. Bot names start with a letter.
+//
+// Parameters:
+//
+//	key (string): The key without its prefix.
+//
+// Returns:
+//
+//	bool: True if the key starts with a chat ID, otherwise false.
+func isLegacyChatKey(key string) bool {
+	return key != "" && (key[0] == '-' || key[0] >= '0' && key[0] <= '9')
+}
+
+// withBotName sets the "bot" field of a JSON object, keeping every other field as it is.
+//
+// Parameters:
+//
+//	value ([]byte): The JSON object.
+//	name (string): The name of the bot.
+//
+// Returns:
+//
+//	[]byte: The updated JSON object.
+//	error: An error if the value is not a JSON object, otherwise nil.
+func withBotName(value []byte, name string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(name)
+	if err != nil {
+		return nil, err
+	}
+	fields["bot"] = encoded
+	return json.Marshal(fields)
+}
+
+// migrateSchema runs the migrations the stored data has not had yet, and records the
+// version of the data once they are done.
+//
+// Parameters:
+//
+//	defaultBot (string): The name of the default bot.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func migrateSchema(defaultBot string) error {
+	version := 0
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaVersionKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			version, err = strconv.Atoi(string(val))
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if version >= schemaVersion {
+		return nil
+	}
+
+	if err := migrateChatKeys(defaultBot); err != nil {
+		return err
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(schemaVersionKey, []byte(strconv.Itoa(schemaVersion)))
+	})
+}
+
+// migrateChatKeys moves the alerts written before keys held the name of their bot to the
+// default bot, and drops the processes in progress of that time.
+//
+// Parameters:
+//
+//	defaultBot (string): The name of the default bot.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func migrateChatKeys(defaultBot string) error {
+	// the write batch commits as it grows, so a large database does not exceed a transaction
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	moved, dropped := 0, 0
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+
+			if isLegacyChatKey(key) {
+				for _, suffix := range legacyProcessSuffixes {
+					if strings.HasSuffix(key, suffix) {
+						if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+							return err
+						}
+						dropped++
+						break
+					}
+				}
+				continue
+			}
+
+			rest, ok := strings.CutPrefix(key, "alert-")
+			if !ok || !isLegacyChatKey(rest) {
+				continue
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if value, err = withBotName(value, defaultBot); err != nil {
+				sugar.Errorw("Failed to unmarshal alert to migrate", "error", err, "key", key)
+				continue
+			}
+			entry := badger.NewEntry([]byte("alert-"+defaultBot+":"+rest), value)
+			entry.ExpiresAt = item.ExpiresAt()
+			if err := wb.SetEntry(entry); err != nil {
+				return err
+			}
+			if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	if moved > 0 || dropped > 0 {
+		sugar.Infow("Migrated chat keys to bot names", "moved", moved, "dropped", dropped)
+	}
+	return nil
+}
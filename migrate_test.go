@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"testing"
+)
+
+func TestParseChatScope(t *testing.T) {
+	tests := []struct {
+		text   string
+		bot    string
+		chatId int64
+		rest   string
+		ok     bool
+	}{
+		{"telegram:123", "telegram", 123, "", true},
+		{"telegram:123-abc", "telegram", 123, "abc", true},
+		{"bale:-100123-abc-def", "bale", -100123, "abc-def", true},
+		{"telegram:-5", "telegram", -5, "", true},
+		{"123-abc", "", 0, "", false},
+		{":123-abc", "", 0, "", false},
+		{"telegram:abc", "", 0, "", false},
+	}
+	for _, test := range tests {
+		bot, chatId, rest, ok := parseChatScope(test.text)
+		if bot != test.bot || chatId != test.chatId || rest != test.rest || ok != test.ok {
+			t.Errorf("parseChatScope(%q) = %q, %d, %q, %v, want %q, %d, %q, %v",
+				test.text, bot, chatId, rest, ok, test.bot, test.chatId, test.rest, test.ok)
+		}
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram", "bale")
+
+	alert, err := json.Marshal(Alert{Id: 7, ChatId: -100, Title: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, value := range map[string][]byte{
+			"alert--100-7":         alert,
+			"-100-CURRENT_PROCESS": []byte("SET_ALERT"),
+			"-100-SET_ALERT":       []byte("{}"),
+			"alert-telegram:5-8":   alert,
+			"post-abc-7":           []byte("{}"),
+		} {
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateSchema("telegram"); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := listAlerts("telegram", -100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Bot != "telegram" || alerts[0].Title != "old" {
+		t.Errorf("alerts of the default bot = %+v, want the old alert", alerts)
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		for _, key := range []string{"alert--100-7", "-100-CURRENT_PROCESS", "-100-SET_ALERT"} {
+			if _, err := txn.Get([]byte(key)); !errors.Is(err, badger.ErrKeyNotFound) {
+				t.Errorf("legacy key %q was kept", key)
+			}
+		}
+		for _, key := range []string{"alert-telegram:5-8", "post-abc-7"} {
+			if _, err := txn.Get([]byte(key)); err != nil {
+				t.Errorf("key %q: %v", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the migration runs once, so later keys are not read as legacy keys
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("alert--100-9"), alert)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSchema("telegram"); err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("alert--100-9"))
+		return err
+	})
+	if err != nil {
+		t.Errorf("the migration ran again: %v", err)
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Channel holds the names of the supported delivery channels.
+//
+// Fields:
+//
+//	Bot (string): Messages sent by the Telegram or Bale bot.
+//	Webhook (string): JSON documents posted to a URL.
+//	Email (string): HTML emails sent through SMTP.
+var Channel = struct {
+	Bot     string
+	Webhook string
+	Email   string
+}{
+	Bot:     "bot",
+	Webhook: "webhook",
+	Email:   "email",
+}
+
+// Recipient identifies where a notification is delivered.
+//
+// Fields:
+//
+//	Channel (string): The delivery channel, one of Channel.
+//	Bot (string): The name of the bot, for the bot channel.
+//	ChatId (int64): The ID of the chat, for the bot channel.
+//	Address (string): The URL of the webhook, or the email address for the email channel.
+type Recipient struct {
+	Channel string `json:"channel"`
+	Bot     string `json:"bot"`
+	ChatId  int64  `json:"chatId"`
+	Address string `json:"address"`
+}
+
+// String returns a key that identifies the recipient, used to keep the order of its notifications.
+func (r Recipient) String() string {
+	return fmt.Sprintf("%s-%s-%d-%s", r.Channel, r.Bot, r.ChatId, r.Address)
+}
+
+// PostNotification is the notification of a new post matched by an alert.
+//
+// Fields:
+//
+//	Alert (Alert): The alert as it was when the post was found.
+//	Post (divar.PostWidget): The new post.
+//	Digest ([]divar.PostWidget): The posts of a digest, when the notification is a digest instead of a single post.
+//	PreviousPrice (string): The price before the change, when the notification is a price change of a tracked post.
+//	AlsoMatched ([]string): The titles of the other alerts of the chat that matched the post.
+//	RepostOf (string): The token of the earlier post, when the post is a repost of it.
+//	ListingStatus (string): The status of a saved or tracked post, when the notification is that it was closed.
+//	Deal (*DealScore): The price per square meter of the post compared with recent posts of the alert, if known.
+type PostNotification struct {
+	Alert         Alert
+	Post          divar.PostWidget
+	Digest        []divar.PostWidget
+	PreviousPrice string
+	AlsoMatched   []string
+	RepostOf      string
+	ListingStatus string
+	Deal          *DealScore
+}
+
+// Notifier delivers post notifications over a delivery channel.
+type Notifier interface {
+	Send(ctx context.Context, recipient Recipient, notification PostNotification) error
+}
+
+// ReadyNotifier is implemented by notifiers that can tell whether a recipient
+// can be sent to right away, so the outbox can skip it instead of blocking.
+type ReadyNotifier interface {
+	Ready(recipient Recipient) bool
+}
+
+// RetryLaterError is returned by a notifier when the delivery channel asked to retry after a delay.
+type RetryLaterError struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *RetryLaterError) Error() string {
+	return fmt.Sprintf("retry after %s: %v", e.After, e.Err)
+}
+
+func (e *RetryLaterError) Unwrap() error {
+	return e.Err
+}
+
+// notifiers holds the notifier of each delivery channel.
+var notifiers = map[string]Notifier{}
+
+// notify delivers a notification through the notifier of the recipient's channel.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel.
+//	recipient (Recipient): The recipient of the notification.
+//	notification (PostNotification): The notification.
+//
+// Returns:
+//
+//	error: An error if the channel is unknown or the delivery fails, otherwise nil.
+func notify(ctx context.Context, notifiers map[string]Notifier, recipient Recipient, notification PostNotification) error {
+	n, ok := notifiers[recipient.Channel]
+	if !ok {
+		return fmt.Errorf("no notifier for channel %q", recipient.Channel)
+	}
+	return n.Send(ctx, recipient, notification)
+}
+
+// notifierReady reports whether the notifier of the recipient's channel can send right away.
+//
+// Parameters:
+//
+//	notifiers (map[string]Notifier): The notifier of each delivery channel.
+//	recipient (Recipient): The recipient of the notification.
+//
+// Returns:
+//
+//	bool: False if the notifier asks to wait, otherwise true.
+func notifierReady(notifiers map[string]Notifier, recipient Recipient) bool {
+	if n, ok := notifiers[recipient.Channel].(ReadyNotifier); ok {
+		return n.Ready(recipient)
+	}
+	return true
+}
+
+// alertRecipients returns the recipients of the notifications of an alert. Channels
+// without a notifier, e.g. email after SMTP was unconfigured, are left out.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel.
+//
+// Returns:
+//
+//	[]Recipient: The recipients of the alert.
+func alertRecipients(alert Alert, notifiers map[string]Notifier) []Recipient {
+	recipients := []Recipient{{Channel: Channel.Bot, Bot: alert.Bot, ChatId: alert.ChatId}}
+	if alert.WebhookURL != "" {
+		recipients = append(recipients, Recipient{Channel: Channel.Webhook, Address: alert.WebhookURL})
+	}
+	if alert.Email != "" {
+		recipients = append(recipients, Recipient{Channel: Channel.Email, Address: alert.Email})
+	}
+	var available []Recipient
+	for _, recipient := range recipients {
+		if _, ok := notifiers[recipient.Channel]; ok {
+			available = append(available, recipient)
+		}
+	}
+	return available
+}
+
+// withoutChannel returns the recipients that are not on the given channel.
+//
+// Parameters:
+//
+//	recipients ([]Recipient): The recipients.
+//	channel (string): The channel to leave out.
+//
+// Returns:
+//
+//	[]Recipient: The remaining recipients.
+func withoutChannel(recipients []Recipient, channel string) []Recipient {
+	var remaining []Recipient
+	for _, recipient := range recipients {
+		if recipient.Channel != channel {
+			remaining = append(remaining, recipient)
+		}
+	}
+	return remaining
+}
+
+// maxImageSize is the largest image downloaded to upload it when the bot API cannot fetch it, the photo upload limit of the bot API.
+const maxImageSize = 10 << 20
+
+// BotNotifier delivers notifications as photo messages of the bot the alert
+// belongs to, within the send rate limits of that bot. Alerts with albums enabled
+// get all images of a post as a media group, and posts without a usable image are
+// sent as text messages with a link preview.
+type BotNotifier struct {
+	Client *http.Client
+}
+
+// postMessage holds what every message of a post notification carries.
+//
+// Fields:
+//
+//	ChatId (int64): The ID of the chat.
+//	Token (string): The token of the post.
+//	Title (string): The title of the post.
+//	Caption (string): The notification text, truncated to the limits of the bot API when sent.
+//	Keyboard (*models.InlineKeyboardMarkup): The action buttons of the post.
+//	ReplyTo (int): The ID of the message the notification replies to, 0 for none.
+type postMessage struct {
+	ChatId   int64
+	Token    string
+	Title    string
+	Caption  string
+	Keyboard *models.InlineKeyboardMarkup
+	ReplyTo  int
+}
+
+// replyParameters returns the reply settings of a post message.
+func (m postMessage) replyParameters() *models.ReplyParameters {
+	if m.ReplyTo == 0 {
+		return nil
+	}
+	return &models.ReplyParameters{MessageID: m.ReplyTo, AllowSendingWithoutReply: true}
+}
+
+func (n *BotNotifier) Ready(recipient Recipient) bool {
+	instance, ok := findBot(recipient.Bot)
+	// an unknown bot is reported by Send, so the notification is dropped
+	return !ok || instance.Limiter.Ready(recipient.ChatId)
+}
+
+func (n *BotNotifier) Send(ctx context.Context, recipient Recipient, notification PostNotification) error {
+	instance, ok := findBot(recipient.Bot)
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnknownBot, recipient.Bot)
+	}
+	post := notification.Post
+	lang := chatLang(instance.Name, recipient.ChatId)
+	msg := postMessage{
+		ChatId:   recipient.ChatId,
+		Token:    post.Data.Token,
+		Title:    post.Data.Title,
+		Caption:  postCaption(notification.Alert, post, lang),
+		Keyboard: postKeyboard(notification.Alert, post, lang),
+	}
+	if notification.PreviousPrice != "" {
+		msg.Caption = tr(lang, priceChangeKey(notification.PreviousPrice, postPrice(post)), notification.PreviousPrice, postPrice(post)) + "\n\n" + msg.Caption
+	}
+	if notification.Deal != nil {
+		msg.Caption = dealText(*notification.Deal, lang) + "\n" + msg.Caption
+	}
+	if len(notification.AlsoMatched) > 0 {
+		msg.Caption = tr(lang, "dedup.alsoMatched", strings.Join(notification.AlsoMatched, tr(lang, "list.separator"))) + "\n" + msg.Caption
+	}
+	if notification.RepostOf != "" {
+		msg.Caption = tr(lang, "repost.tag", postURL(notification.RepostOf)) + "\n\n" + msg.Caption
+		msg.ReplyTo = sentMessageId(instance.Name, recipient.ChatId, notification.RepostOf)
+	}
+	if notification.ListingStatus != "" {
+		// the post is no longer published, so only the link to it is kept
+		msg.Caption = tr(lang, "listing.closed", tr(lang, "listing.status."+notification.ListingStatus), post.Data.Title, postURL(post.Data.Token))
+		msg.Keyboard = &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: tr(lang, "button.open"), URL: postURL(post.Data.Token)}},
+		}}
+		msg.ReplyTo = sentMessageId(instance.Name, recipient.ChatId, post.Data.Token)
+	}
+
+	if notification.Alert.Album && post.Data.ImageCount > 1 {
+		err := n.sendAlbum(ctx, instance, msg)
+		if err == nil || retryAfter(err) > 0 {
+			return err
+		}
+		sugar.Infow("Sending post without album", "error", err, "token", post.Data.Token)
+	}
+
+	if post.Data.ImageURL != "" {
+		err := n.sendPhoto(ctx, instance, msg, &models.InputFileString{Data: post.Data.ImageURL})
+		if !errors.Is(err, bot.ErrorBadRequest) {
+			return err
+		}
+
+		// the bot API could not fetch the image itself, so upload it instead
+		image, downloadErr := n.downloadImage(ctx, post.Data.ImageURL)
+		if downloadErr == nil {
+			photo := &models.InputFileUpload{Filename: post.Data.Token + ".jpg", Data: bytes.NewReader(image)}
+			err = n.sendPhoto(ctx, instance, msg, photo)
+			if !errors.Is(err, bot.ErrorBadRequest) {
+				return err
+			}
+		} else {
+			err = downloadErr
+		}
+		sugar.Infow("Sending post without image", "error", err, "token", post.Data.Token)
+	}
+
+	if err := instance.Limiter.Wait(ctx, msg.ChatId); err != nil {
+		return err
+	}
+	link := postURL(post.Data.Token)
+	sent, err := instance.Bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:             msg.ChatId,
+		Text:               truncateText(msg.Caption, maxMessageLength),
+		LinkPreviewOptions: &models.LinkPreviewOptions{URL: &link, PreferLargeMedia: bot.True()},
+		ReplyParameters:    msg.replyParameters(),
+		ReplyMarkup:        msg.Keyboard,
+	})
+	if err == nil {
+		rememberMessage(instance.Name, msg.ChatId, msg.Token, sent.ID)
+	}
+	return observeSend(instance, err)
+}
+
+// sendPhoto sends a photo message within the send rate limits of the bot.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery.
+//	instance (*botInstance): The bot that sends the message.
+//	msg (postMessage): The message.
+//	photo (models.InputFile): The photo, as a URL or an upload.
+//
+// Returns:
+//
+//	error: A *RetryLaterError if the bot API asked to retry later, another error if the message cannot be sent, otherwise nil.
+func (n *BotNotifier) sendPhoto(ctx context.Context, instance *botInstance, msg postMessage, photo models.InputFile) error {
+	if err := instance.Limiter.Wait(ctx, msg.ChatId); err != nil {
+		return err
+	}
+	sent, err := instance.Bot.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:          msg.ChatId,
+		Photo:           photo,
+		Caption:         truncateText(msg.Caption, maxCaptionLength),
+		ReplyParameters: msg.replyParameters(),
+		ReplyMarkup:     msg.Keyboard,
+	})
+	if err == nil {
+		rememberMessage(instance.Name, msg.ChatId, msg.Token, sent.ID)
+	}
+	return observeSend(instance, err)
+}
+
+// sendAlbum sends the images of a post as a media group, with the caption on the first image.
+// Media groups cannot have buttons, so the action buttons follow in a message of their own.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery.
+//	instance (*botInstance): The bot that sends the message.
+//	msg (postMessage): The message, whose post images are read from the post page.
+//
+// Returns:
+//
+//	error: A *RetryLaterError if the bot API asked to retry later, another error if the album cannot be sent, otherwise nil.
+func (n *BotNotifier) sendAlbum(ctx context.Context, instance *botInstance, msg postMessage) error {
+	detail, err := divar.GetPost(ctx, msg.Token)
+	if err != nil {
+		return err
+	}
+	images := detail.ImageURLs()
+	if len(images) < 2 {
+		return errors.New("post page has less than two images")
+	}
+
+	var media []models.InputMedia
+	for i, image := range images[:min(maxMediaGroupSize, len(images))] {
+		photo := &models.InputMediaPhoto{Media: image}
+		if i == 0 {
+			photo.Caption = truncateText(msg.Caption, maxCaptionLength)
+		}
+		media = append(media, photo)
+	}
+
+	if err := instance.Limiter.Wait(ctx, msg.ChatId); err != nil {
+		return err
+	}
+	sent, err := instance.Bot.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+		ChatID:          msg.ChatId,
+		Media:           media,
+		ReplyParameters: msg.replyParameters(),
+	})
+	if err := observeSend(instance, err); err != nil {
+		return err
+	}
+	if len(sent) > 0 {
+		rememberMessage(instance.Name, msg.ChatId, msg.Token, sent[0].ID)
+	}
+
+	// the album is delivered, so a failure here must not send it again
+	if err := instance.Limiter.Wait(ctx, msg.ChatId); err != nil {
+		return nil
+	}
+	_, err = instance.Bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      msg.ChatId,
+		Text:        msg.Title,
+		ReplyMarkup: msg.Keyboard,
+	})
+	if err != nil {
+		instance.Limiter.Observe(err)
+		sugar.Errorw("Failed to send album buttons", "error", err, "token", msg.Token)
+	}
+	return nil
+}
+
+// downloadImage downloads the image of a post, so it can be uploaded to the bot API.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery.
+//	imageURL (string): The URL of the image.
+//
+// Returns:
+//
+//	[]byte: The image.
+//	error: An error if the image cannot be downloaded or is too large, otherwise nil.
+func (n *BotNotifier) downloadImage(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image download responded with %s", res.Status)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(res.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > maxImageSize {
+		return nil, errors.New("image is too large to upload")
+	}
+	return image, nil
+}
+
+// observeSend reports the result of a request to the rate limiter of the bot.
+//
+// Parameters:
+//
+//	instance (*botInstance): The bot that sent the request.
+//	err (error): The error returned by the bot API.
+//
+// Returns:
+//
+//	error: A *RetryLaterError if the bot API asked to retry later, otherwise err.
+func observeSend(instance *botInstance, err error) error {
+	if retryAfter := instance.Limiter.Observe(err); retryAfter > 0 {
+		return &RetryLaterError{After: retryAfter, Err: err}
+	}
+	return err
+}
+
+// retryAfter returns the delay requested by a notifier error, 0 if none was requested.
+//
+// Parameters:
+//
+//	err (error): The error returned by the notifier.
+//
+// Returns:
+//
+//	time.Duration: The delay before retrying.
+func retryAfter(err error) time.Duration {
+	var retryLater *RetryLaterError
+	if errors.As(err, &retryLater) {
+		return retryLater.After
+	}
+	return 0
+}
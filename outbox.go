@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"time"
+)
+
+// maxOutboxAttempts is the number of failed deliveries after which a notification is dropped.
+const maxOutboxAttempts = 20
+
+// errUndeliverable marks the errors of notifications that cannot succeed on a retry, which are dropped right away.
+var errUndeliverable = errors.New("notification cannot be delivered")
+
+// outboxPollInterval is how often the sender looks for notifications to deliver.
+const outboxPollInterval = 1 * time.Second
+
+// enqueueNotification adds a notification of a post to the outbox,
+// one item per recipient. It is meant to run in the same transaction
+// that marks the post as seen, so a post is either both seen and pending, or neither.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	notification (PostNotification): The notification of a single post.
+//	recipients ([]Recipient): The recipients of the notification.
+//
+// Returns:
+//
+//	[]string: The outbox keys of the notifications, in the order of the recipients.
+//	error: An error if the operation fails, otherwise nil.
+func enqueueNotification(txn *badger.Txn, notification PostNotification, recipients []Recipient) ([]string, error) {
+	now := time.Now()
+	var keys []string
+	for i, recipient := range recipients {
+		item := OutboxItem{
+			Key:           fmt.Sprintf("outbox-%d-%s-%d", now.UnixNano(), notification.Post.Data.Token, i),
+			Recipient:     recipient,
+			Alert:         notification.Alert,
+			Post:          notification.Post,
+			CreatedAt:     now.Unix(),
+			NextAttemptAt: now.Unix(),
+			PreviousPrice: notification.PreviousPrice,
+			AlsoMatched:   notification.AlsoMatched,
+			RepostOf:      notification.RepostOf,
+			ListingStatus: notification.ListingStatus,
+			Deal:          notification.Deal,
+		}
+		if err := saveOutboxItem(txn, item); err != nil {
+			return nil, err
+		}
+		keys = append(keys, item.Key)
+	}
+	return keys, nil
+}
+
+// saveOutboxItem writes an outbox item to the database within the given transaction.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	item (OutboxItem): The outbox item.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func saveOutboxItem(txn *badger.Txn, item OutboxItem) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(item.Key), value)
+}
+
+// outboxBackoff returns how long to wait before retrying a notification.
+//
+// Parameters:
+//
+//	attempts (int): The number of failed deliveries so far.
+//
+// Returns:
+//
+//	time.Duration: The delay before the next attempt, doubling from 5 seconds up to 1 hour.
+func outboxBackoff(attempts int) time.Duration {
+	delay := 5 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// readOutbox reads all pending notifications in the order they were enqueued.
+//
+// Returns:
+//
+//	[]OutboxItem: The pending notifications.
+//	error: An error if the outbox cannot be read, otherwise nil.
+func readOutbox() ([]OutboxItem, error) {
+	var items []OutboxItem
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("outbox-")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var item OutboxItem
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &item)
+			})
+			if err != nil {
+				sugar.Errorw("Failed to unmarshal outbox item", "error", err, "key", string(it.Item().Key()))
+				continue
+			}
+			if item.Recipient.Channel == "" {
+				// queued before notifications had recipients
+				item.Recipient = Recipient{Channel: Channel.Bot, Bot: item.Alert.Bot, ChatId: item.Alert.ChatId}
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// deliverOutbox tries to deliver every due notification once through its notifier.
+// A delivered notification is removed from the outbox; a failed one is rescheduled with
+// backoff, or after the delay requested by the delivery channel. Once a notification of
+// a recipient has to wait, the later ones of that recipient wait too, to keep their order.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the delivery.
+//	notifiers (map[string]Notifier): The notifier of each delivery channel.
+func deliverOutbox(ctx context.Context, notifiers map[string]Notifier) {
+	items, err := readOutbox()
+	if err != nil {
+		sugar.Errorw("Failed to read outbox", "error", err)
+		return
+	}
+
+	blocked := map[string]bool{}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		recipient := item.Recipient.String()
+		if blocked[recipient] {
+			continue
+		}
+		if item.NextAttemptAt > time.Now().Unix() || !notifierReady(notifiers, item.Recipient) {
+			blocked[recipient] = true
+			continue
+		}
+
+		err := notify(ctx, notifiers, item.Recipient, PostNotification{Alert: item.Alert, Post: item.Post, Digest: item.Digest, PreviousPrice: item.PreviousPrice, AlsoMatched: item.AlsoMatched, RepostOf: item.RepostOf, ListingStatus: item.ListingStatus, Deal: item.Deal})
+		if err == nil {
+			err = db.Update(func(txn *badger.Txn) error {
+				return txn.Delete([]byte(item.Key))
+			})
+			if err != nil {
+				sugar.Errorw("Failed to remove delivered notification from outbox", "error", err, "key", item.Key)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, errUndeliverable) {
+			sugar.Errorw("Dropping notification that cannot be delivered", "error", err, "alert", item.Alert.Title, "post", item.Post.Data.Title)
+			err = db.Update(func(txn *badger.Txn) error {
+				return txn.Delete([]byte(item.Key))
+			})
+			if err != nil {
+				sugar.Errorw("Failed to remove notification from outbox", "error", err, "key", item.Key)
+			}
+			continue
+		}
+
+		item.LastError = err.Error()
+		blocked[recipient] = true
+		if delay := retryAfter(err); delay > 0 {
+			// a requested delay is not a failure of the notification itself
+			sugar.Warnw("Delivery channel asked to retry later", "retryAfter", delay, "recipient", recipient)
+			item.NextAttemptAt = time.Now().Add(delay).Unix()
+			err = db.Update(func(txn *badger.Txn) error {
+				return saveOutboxItem(txn, item)
+			})
+			if err != nil {
+				sugar.Errorw("Failed to update outbox item", "error", err, "key", item.Key)
+			}
+			continue
+		}
+
+		item.Attempts++
+		if item.Attempts >= maxOutboxAttempts {
+			sugar.Errorw("Dropping notification after too many failed attempts", "error", err, "alert", item.Alert.Title, "post", item.Post.Data.Title)
+			err = db.Update(func(txn *badger.Txn) error {
+				return txn.Delete([]byte(item.Key))
+			})
+		} else {
+			sugar.Warnw("Failed to send notification, will retry", "error", err, "alert", item.Alert.Title, "attempts", item.Attempts)
+			item.NextAttemptAt = time.Now().Add(outboxBackoff(item.Attempts)).Unix()
+			err = db.Update(func(txn *badger.Txn) error {
+				return saveOutboxItem(txn, item)
+			})
+		}
+		if err != nil {
+			sugar.Errorw("Failed to update outbox item", "error", err, "key", item.Key)
+		}
+	}
+}
+
+// runOutbox delivers pending notifications until the context is cancelled.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context that stops the sender.
+func runOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		deliverOutbox(ctx, notifiers)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
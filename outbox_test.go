@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+)
+
+func TestFindBot(t *testing.T) {
+	setTestBots(t, "telegram", "bale")
+
+	if instance, ok := findBot("bale"); !ok || instance.Name != "bale" {
+		t.Errorf("findBot(bale) = %v, %v, want bale", instance, ok)
+	}
+	if instance, ok := findBot("eitaa"); ok {
+		t.Errorf("findBot(eitaa) = %v, want no bot", instance.Name)
+	}
+}
+
+func TestDeliverOutboxDropsUnknownBot(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	previous := notifiers[Channel.Bot]
+	notifiers[Channel.Bot] = &BotNotifier{}
+	t.Cleanup(func() { notifiers[Channel.Bot] = previous })
+
+	var post divar.PostWidget
+	post.Data.Token = "abc"
+	err := db.Update(func(txn *badger.Txn) error {
+		_, err := enqueueNotification(txn, PostNotification{Post: post}, []Recipient{{Channel: Channel.Bot, Bot: "gone", ChatId: 1}})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliverOutbox(context.Background(), notifiers)
+
+	items, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("outbox holds %d items, want the notification of the unknown bot dropped", len(items))
+	}
+	if err := notify(context.Background(), notifiers, Recipient{Channel: Channel.Bot, Bot: "gone"}, PostNotification{Post: post}); !errors.Is(err, errUnknownBot) {
+		t.Errorf("notify() error = %v, want errUnknownBot", err)
+	}
+}
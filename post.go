@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mrmohebi/divar-alert/divar"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf16"
+)
+
+// postURL builds the public Divar link of a post.
+//
+// Parameters:
+//
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	string: The link of the post on divar.ir.
+func postURL(token string) string {
+	return fmt.Sprintf("https://divar.ir/v/%s", token)
+}
+
+// CaptionData holds the fields available to the notification template of an alert.
+type CaptionData struct {
+	AlertTitle        string
+	Title             string
+	TopDescription    string
+	MiddleDescription string
+	BottomDescription string
+	Price             string
+	URL               string
+	Token             string
+	ImageURL          string
+}
+
+// newCaptionData builds the template fields of a new post for an alert.
+//
+// Parameters:
+//
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The new post.
+//
+// Returns:
+//
+//	CaptionData: The template fields.
+func newCaptionData(alert Alert, post divar.PostWidget) CaptionData {
+	return CaptionData{
+		AlertTitle:        alert.Title,
+		Title:             post.Data.Title,
+		TopDescription:    post.Data.TopDescriptionText,
+		MiddleDescription: post.Data.MiddleDescriptionText,
+		BottomDescription: post.Data.BottomDescriptionText,
+		Price:             postPrice(post),
+		URL:               postURL(post.Data.Token),
+		Token:             post.Data.Token,
+		ImageURL:          post.Data.ImageURL,
+	}
+}
+
+// maxCaptionOutput is the maximum size of the text rendered by a template, in bytes. It leaves
+// room for a caption in Persian, whose letters take two bytes, before it is truncated.
+const maxCaptionOutput = 4 * maxCaptionLength
+
+// errCaptionTooLong is returned when a template renders more than maxCaptionOutput bytes.
+var errCaptionTooLong = fmt.Errorf("the text is longer than %d bytes", maxCaptionOutput)
+
+// cappedWriter collects the output of a template, failing once it grows past its limit.
+type cappedWriter struct {
+	out   strings.Builder
+	limit int
+}
+
+// Write appends p to the output, unless the output would grow past the limit.
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	if w.out.Len()+len(p) > w.limit {
+		return 0, errCaptionTooLong
+	}
+	return w.out.Write(p)
+}
+
+// checkTemplateNodes rejects the actions that repeat a part of a template, so rendering takes
+// time in proportion to the template. The fields of CaptionData are texts, which need no loops.
+//
+// Parameters:
+//
+//	node (parse.Node): The node to check, with its children.
+//
+// Returns:
+//
+//	error: An error naming the first loop or template call found, otherwise nil.
+func checkTemplateNodes(node parse.Node) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkTemplateNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkBranchNodes(&node.BranchNode)
+	case *parse.WithNode:
+		return checkBranchNodes(&node.BranchNode)
+	case *parse.RangeNode, *parse.TemplateNode:
+		return fmt.Errorf("%s is not supported", node)
+	}
+	return nil
+}
+
+// checkBranchNodes checks both lists of an if or with action with checkTemplateNodes.
+//
+// Parameters:
+//
+//	node (*parse.BranchNode): The action.
+//
+// Returns:
+//
+//	error: An error naming the first loop or template call found, otherwise nil.
+func checkBranchNodes(node *parse.BranchNode) error {
+	if err := checkTemplateNodes(node.List); err != nil {
+		return err
+	}
+	return checkTemplateNodes(node.ElseList)
+}
+
+// renderCaption executes a notification template. Templates may not loop or define and call
+// other templates, and their output is limited to maxCaptionOutput bytes.
+//
+// Parameters:
+//
+//	text (string): The text/template source.
+//	data (CaptionData): The template fields.
+//
+// Returns:
+//
+//	string: The rendered text.
+//	error: An error if the template is invalid, fails or renders too much, otherwise nil.
+func renderCaption(text string, data CaptionData) (string, error) {
+	tmpl, err := template.New("caption").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return "", errors.New("define and block are not supported")
+	}
+	if tmpl.Tree != nil {
+		if err := checkTemplateNodes(tmpl.Tree.Root); err != nil {
+			return "", err
+		}
+	}
+	out := &cappedWriter{limit: maxCaptionOutput}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", err
+	}
+	return out.out.String(), nil
+}
+
+// postCaption builds the notification text of a new post for an alert, from the
+// template of the alert or the default template of the language.
+//
+// Parameters:
+//
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The new post.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	string: The notification text.
+func postCaption(alert Alert, post divar.PostWidget, lang string) string {
+	data := newCaptionData(alert, post)
+	if alert.Template != "" {
+		text, err := renderCaption(alert.Template, data)
+		if err == nil && strings.TrimSpace(text) != "" {
+			return text
+		}
+		sugar.Errorw("Failed to render alert template", "error", err, "alert", alert.Title)
+	}
+	text, _ := renderCaption(tr(lang, "caption.default"), data)
+	return text
+}
+
+// setAlertTemplate sets the notification template of an alert.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): A text/template over the fields of CaptionData, or "off" to use the default template.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the template is invalid, otherwise nil.
+func setAlertTemplate(alert *Alert, value string) error {
+	if value == "off" {
+		alert.Template = ""
+		return nil
+	}
+	sample := CaptionData{
+		AlertTitle: alert.Title,
+		Title:      "title",
+		Price:      "1,000 تومان",
+		URL:        postURL("token"),
+		Token:      "token",
+	}
+	if _, err := renderCaption(value, sample); err != nil {
+		return &ProcessInputError{Key: "edit.template.invalid", Args: []any{err.Error()}}
+	}
+	alert.Template = value
+	return nil
+}
+
+// postPrice returns the description field of a post that holds its price, if any.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	string: The price text, e.g. "۲٬۵۰۰٬۰۰۰ تومان", or an empty string.
+func postPrice(post divar.PostWidget) string {
+	for _, text := range []string{post.Data.MiddleDescriptionText, post.Data.TopDescriptionText, post.Data.BottomDescriptionText} {
+		if strings.Contains(text, "تومان") || strings.Contains(text, "توافقی") || strings.Contains(text, "مجانی") {
+			return strings.TrimSpace(text)
+		}
+	}
+	return ""
+}
+
+// setAlertAlbum sets whether all images of the new posts of an alert are sent as an album.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): "on" to send albums, or "off" to send only the first image.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the value is neither "on" nor "off", otherwise nil.
+func setAlertAlbum(alert *Alert, value string) error {
+	switch strings.ToLower(value) {
+	case "on":
+		alert.Album = true
+	case "off":
+		alert.Album = false
+	default:
+		return &ProcessInputError{Key: "edit.onOff.invalid"}
+	}
+	return nil
+}
+
+// textLength returns the length of a text as the bot API counts it, in UTF-16 code units,
+// so characters outside the Basic Multilingual Plane, such as emoji, count twice.
+//
+// Parameters:
+//
+//	text (string): The text.
+//
+// Returns:
+//
+//	int: The length of the text.
+func textLength(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+// truncateText shortens a text to a length limit of the bot API, marking the cut with an ellipsis.
+//
+// Parameters:
+//
+//	text (string): The text.
+//	limit (int): The maximum length, in UTF-16 code units.
+//
+// Returns:
+//
+//	string: The text, shortened if it exceeds the limit.
+func truncateText(text string, limit int) string {
+	if textLength(text) <= limit {
+		return text
+	}
+	// the ellipsis takes one unit, and a character is never split
+	length := 0
+	for i, r := range text {
+		if length+utf16.RuneLen(r) > limit-1 {
+			return text[:i] + "…"
+		}
+		length += utf16.RuneLen(r)
+	}
+	return text
+}
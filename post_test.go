@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"flat", 4},
+		{"آپارتمان", 8},
+		{"🏠", 2},
+		{"🏠 flat", 7},
+	}
+	for _, test := range tests {
+		if got := textLength(test.text); got != test.want {
+			t.Errorf("textLength(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"flat", 4, "flat"},
+		{"flats", 4, "fla…"},
+		{"آپارتمان", 5, "آپار…"},
+		// an emoji takes two units and is not split
+		{"ab🏠cd", 5, "ab🏠…"},
+		{"ab🏠cd", 4, "ab…"},
+		{strings.Repeat("🏠", 600), maxCaptionLength, strings.Repeat("🏠", 511) + "…"},
+	}
+	for _, test := range tests {
+		got := truncateText(test.text, test.limit)
+		if got != test.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+		if textLength(got) > test.limit {
+			t.Errorf("truncateText(%q, %d) is %d units long", test.text, test.limit, textLength(got))
+		}
+	}
+}
+
+func TestSetAlertTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		ok       bool
+	}{
+		{"{{.Title}} {{.Price}}\n{{.URL}}", true},
+		{"{{if .Price}}{{.Price}}{{else}}-{{end}} {{with .Title}}{{.}}{{end}}", true},
+		{"{{.Missing}}", false},
+		{"{{range 2000000000}}{{end}}", false},
+		{"{{if .Title}}{{range 10}}x{{end}}{{end}}", false},
+		{`{{define "a"}}{{.Title}}{{end}}{{template "a" .}}`, false},
+		{strings.Repeat("{{.URL}}", maxCaptionOutput/len(postURL("token"))+1), false},
+	}
+	for _, test := range tests {
+		alert := Alert{Title: "flats"}
+		err := setAlertTemplate(&alert, test.template)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("setAlertTemplate(%.40q) error = %v, want ok %v", test.template, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// priceChangePercent returns the largest change in percent between the amounts of two
+// price attributes: the sale price, the deposit and the rent.
+//
+// Parameters:
+//
+//	previous (divar.PostAttributes): The attributes before the change.
+//	current (divar.PostAttributes): The attributes after the change.
+//
+// Returns:
+//
+//	float64: The largest change in percent, always positive.
+//	bool: False if no amount is known both before and after the change.
+func priceChangePercent(previous divar.PostAttributes, current divar.PostAttributes) (float64, bool) {
+	change, known := 0.0, false
+	for _, pair := range [][2]int64{
+		{previous.Price, current.Price},
+		{previous.Deposit, current.Deposit},
+		{previous.Rent, current.Rent},
+	} {
+		if pair[0] <= 0 || pair[1] <= 0 {
+			continue
+		}
+		change = max(change, math.Abs(float64(pair[1]-pair[0]))/float64(pair[0])*100)
+		known = true
+	}
+	return change, known
+}
+
+// priceChangeKey returns the catalog key of the text that introduces a price change.
+//
+// Parameters:
+//
+//	previous (string): The price text before the change.
+//	current (string): The price text after the change.
+//
+// Returns:
+//
+//	string: "price.dropped" or "price.rose" if both texts hold an amount, otherwise "price.changed".
+func priceChangeKey(previous string, current string) string {
+	previousAmount, ok := divar.ParseAmount(previous)
+	currentAmount, ok2 := divar.ParseAmount(current)
+	switch {
+	case !ok || !ok2 || previousAmount == currentAmount:
+		return "price.changed"
+	case currentAmount < previousAmount:
+		return "price.dropped"
+	default:
+		return "price.rose"
+	}
+}
+
+// checkSeenPrice compares a listed post with the post stored when the alert first found it,
+// and queues a notification to the chat when its price changed by at least the threshold of
+// the alert. The stored post is replaced when the change is sent, or when only its other
+// texts changed, so smaller price changes add up until they reach the threshold. Posts the
+// chat never got are skipped, and the post must still pass the filters of the alert. During
+// the quiet hours of the chat the change is deferred like new posts.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that listed the post.
+//	market (alertMarket): The recent prices of the alert, to score the post against.
+//	item (*badger.Item): The seen marker of the post.
+//	post (divar.PostWidget): The post as currently listed.
+//	quiet (bool): Whether the chat is in its quiet hours.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func checkSeenPrice(txn *badger.Txn, alert Alert, market alertMarket, item *badger.Item, post divar.PostWidget, quiet bool) error {
+	var seen SeenPost
+	err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &seen)
+	})
+	if err != nil {
+		return err
+	}
+	if seen.Skipped {
+		return nil
+	}
+	// the bottom description holds the time of the post, which changes on every check
+	if seen.Data.Title == post.Data.Title &&
+		seen.Data.TopDescriptionText == post.Data.TopDescriptionText &&
+		seen.Data.MiddleDescriptionText == post.Data.MiddleDescriptionText {
+		return nil
+	}
+
+	previousPrice, price := postPrice(seen.PostWidget), postPrice(post)
+	changed := previousPrice != "" && price != "" && previousPrice != price
+	if changed {
+		change, known := priceChangePercent(seen.Attributes(), post.Attributes())
+		if known && change < alert.PriceThreshold {
+			// keep the stored price, so the next change is compared with it
+			return nil
+		}
+	}
+
+	if err := saveSeenPost(txn, item.KeyCopy(nil), SeenPost{PostWidget: post}); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	// tracked posts get their price changes from checkTrackedPrice
+	_, err = txn.Get(trackedKey(alert.Bot, alert.ChatId, post.Data.Token))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	if isHidden(txn, alert.Bot, alert.ChatId, post) || !matchesFilters(alert, post) || !matchesRule(alert, post) || !matchesDeal(alert, market, market.Score(post)) {
+		return nil
+	}
+	if alert.Reposts == RepostMode.Hide {
+		repostOf, err := findRepost(txn, alert, post)
+		if err != nil || repostOf != "" {
+			return err
+		}
+	}
+
+	if quiet {
+		note := tr(chatLang(alert.Bot, alert.ChatId), priceChangeKey(previousPrice, price), previousPrice, price)
+		_, err = deferPostWithNote(txn, alert, post, note)
+		return err
+	}
+	recipient := Recipient{Channel: Channel.Bot, Bot: alert.Bot, ChatId: alert.ChatId}
+	_, err = enqueueNotification(txn, PostNotification{Alert: alert, Post: post, PreviousPrice: previousPrice}, []Recipient{recipient})
+	return err
+}
+
+// setAlertPriceChanges sets whether price changes of the posts already sent by an alert are sent.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): "on" to send every change, a percentage such as "5" or "5%" to send
+//	  changes of at least that much, or "off".
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the value is none of them, otherwise nil.
+func setAlertPriceChanges(alert *Alert, value string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "on":
+		alert.PriceChanges = true
+		alert.PriceThreshold = 0
+		return nil
+	case "off":
+		alert.PriceChanges = false
+		alert.PriceThreshold = 0
+		return nil
+	}
+
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(divar.NormalizeDigits(value), "%"), 64)
+	if err != nil || threshold < 0 || threshold > 100 || math.IsNaN(threshold) {
+		return &ProcessInputError{Key: "edit.priceChanges.invalid"}
+	}
+	alert.PriceChanges = true
+	alert.PriceThreshold = threshold
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+	"time"
+)
+
+// pricedPost builds a listed post with the given price text.
+func pricedPost(token string, price string) divar.PostWidget {
+	post := testPost(token, "آپارتمان")
+	post.Data.MiddleDescriptionText = price
+	post.Data.ImageURL = "https://example.com/" + token + ".jpg"
+	return post
+}
+
+// runPriceCheck runs a scheduler pass that lists the given posts, and returns the price
+// changes queued for the chat by it.
+func runPriceCheck(t *testing.T, posts ...divar.PostWidget) []OutboxItem {
+	t.Helper()
+	before, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(link string) (divar.SearchRes, error) {
+		return divar.SearchRes{ListWidgets: posts}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+	after, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, item := range before {
+		seen[item.Key] = true
+	}
+	var changes []OutboxItem
+	for _, item := range after {
+		if !seen[item.Key] && item.PreviousPrice != "" {
+			changes = append(changes, item)
+		}
+	}
+	return changes
+}
+
+func TestPriceChangeThreshold(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true, PriceThreshold: 10})
+
+	runPriceCheck(t, pricedPost("a", "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان"))
+	// 5% is below the threshold, and is kept to add up with the next change
+	if changes := runPriceCheck(t, pricedPost("a", "۹۵۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 0 {
+		t.Errorf("a 5%% change was sent: %+v", changes)
+	}
+	changes := runPriceCheck(t, pricedPost("a", "۸۸۰٬۰۰۰٬۰۰۰ تومان"))
+	if len(changes) != 1 || changes[0].PreviousPrice != "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان" {
+		t.Fatalf("changes = %+v, want the 12%% drop from the first price", changes)
+	}
+	if changes := runPriceCheck(t, pricedPost("a", "۸۷۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 0 {
+		t.Errorf("a 1%% change after a sent change was sent: %+v", changes)
+	}
+}
+
+func TestPriceChangesOfSkippedPosts(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true, MutedUntil: 1 << 40})
+	runPriceCheck(t, pricedPost("a", "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان"))
+
+	// the post arrived while muted, so its price changes are not sent once the alert is unmuted
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true})
+	if changes := runPriceCheck(t, pricedPost("a", "۹۰۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 0 {
+		t.Errorf("price change of a post found while muted was sent: %+v", changes)
+	}
+
+	// a post filtered out when it was found stays skipped after it passes the filters
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true, Exclude: []string{"۹۰۰"}})
+	runPriceCheck(t, pricedPost("b", "۹۰۰٬۰۰۰٬۰۰۰ تومان"))
+	if changes := runPriceCheck(t, pricedPost("b", "۸۰۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 0 {
+		t.Errorf("price change of a filtered post was sent: %+v", changes)
+	}
+
+	// a post the chat got has its changes sent
+	runPriceCheck(t, pricedPost("c", "۵۰۰٬۰۰۰٬۰۰۰ تومان"))
+	if changes := runPriceCheck(t, pricedPost("c", "۴۰۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 1 {
+		t.Errorf("changes = %+v, want the change of the post the chat got", changes)
+	}
+}
+
+func TestPriceChangeOfHiddenRepost(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true, Reposts: RepostMode.Hide})
+
+	runPriceCheck(t, pricedPost("a", "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان"))
+	// the same flat at a new price under a new token, which the chat gets
+	repost := pricedPost("b", "۹۰۰٬۰۰۰٬۰۰۰ تومان")
+	repost.Data.ImageURL = "https://example.com/a.jpg"
+	runPriceCheck(t, repost)
+
+	moved := pricedPost("a", "۹۰۰٬۰۰۰٬۰۰۰ تومان")
+	if changes := runPriceCheck(t, moved); len(changes) != 0 {
+		t.Errorf("price change matching a post the chat already got was sent: %+v", changes)
+	}
+}
+
+func TestPriceChangeDuringQuietHours(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", PriceChanges: true})
+	runPriceCheck(t, pricedPost("a", "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان"))
+
+	now := time.Now().In(tehran)
+	_, err := updateChat("telegram", 10, func(chat *Chat) {
+		chat.QuietStart = now.Add(-time.Hour).Format("15:04")
+		chat.QuietEnd = now.Add(time.Hour).Format("15:04")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := runPriceCheck(t, pricedPost("a", "۹۰۰٬۰۰۰٬۰۰۰ تومان")); len(changes) != 0 {
+		t.Errorf("a price change was sent during quiet hours: %+v", changes)
+	}
+	deferred, err := readQueue("deferred-" + chatScope("telegram", 10) + "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tr(defaultLang, "price.dropped", "۱٬۰۰۰٬۰۰۰٬۰۰۰ تومان", "۹۰۰٬۰۰۰٬۰۰۰ تومان")
+	if len(deferred) != 1 || deferred[0].post.Note != want {
+		t.Errorf("deferred = %+v, want the drop with the note %q", deferred, want)
+	}
+}
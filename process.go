@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/dgraph-io/badger/v4"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,12 +31,14 @@ type Step struct {
 //	Step ([]Step): The list of steps in the process.
 //	CurrentStepIndex (int): The index of the current step in the process.
 //	ChatId (int64): The ID of the chat associated with the process.
+//	Bot (string): The name of the bot the process was started on.
 //	LastActionAt (int64): The timestamp of the last action performed in the process.
 type Process struct {
 	Id               string `json:"id"`
 	Step             []Step `json:"step"`
 	CurrentStepIndex int    `json:"currentStepIndex"`
 	ChatId           int64  `json:"chatId"`
+	Bot              string `json:"bot"`
 	LastActionAt     int64  `json:"lastActionAt"`
 }
 
@@ -44,10 +47,29 @@ type Process struct {
 // Fields:
 //
 //	SetAlert (string): The key for the "SET_ALERT" process.
+//	EditAlert (string): The key for the "EDIT_ALERT" process.
 var ProcessKey = struct {
-	SetAlert string
+	SetAlert  string
+	EditAlert string
 }{
-	SetAlert: "SET_ALERT",
+	SetAlert:  "SET_ALERT",
+	EditAlert: "EDIT_ALERT",
+}
+
+// ProcessInputError is returned when the data entered during a process is invalid.
+// Its message is shown to the user in the language of the chat.
+//
+// Fields:
+//
+//	Key (string): The key of the message in the catalog.
+//	Args ([]any): The arguments of the message.
+type ProcessInputError struct {
+	Key  string
+	Args []any
+}
+
+func (e *ProcessInputError) Error() string {
+	return tr(Lang.En, e.Key, e.Args...)
 }
 
 // setAlertEmpty initializes a new "SET_ALERT" process with predefined steps.
@@ -55,33 +77,49 @@ var ProcessKey = struct {
 // Parameters:
 //
 //	chatId (int64): The ID of the chat for which the process is being created.
+//	lang (string): The language of the step messages.
 //
 // Returns:
 //
 //	Process: A new "SET_ALERT" process with predefined steps and metadata.
-func setAlertEmpty(chatId int64) Process {
+func setAlertEmpty(chatId int64, lang string) Process {
 	return Process{
 		Id: ProcessKey.SetAlert,
 		Step: []Step{
 			{
 				Name:    "title",
 				Data:    "",
-				Message: "لطفا عنوان اعلان را ارسال کنید:",
+				Message: tr(lang, "step.title"),
 			},
 			{
 				Name:    "link",
 				Data:    "",
-				Message: "لطفا لینک دیوار را ارسال کنید:",
+				Message: tr(lang, "step.link"),
 			},
 			{
 				Name:    "interval",
 				Data:    "",
-				Message: "هر چند ثانیه میخواهید چک شود؟",
+				Message: tr(lang, "step.interval"),
+			},
+			{
+				Name:    "delivery",
+				Data:    "",
+				Message: tr(lang, "step.delivery"),
+			},
+			{
+				Name:    "include",
+				Data:    "",
+				Message: tr(lang, "step.include"),
+			},
+			{
+				Name:    "exclude",
+				Data:    "",
+				Message: tr(lang, "step.exclude"),
 			},
 			{
 				Name:    "end",
 				Data:    "",
-				Message: "اعلان با موفقیت تنظیم شد.",
+				Message: tr(lang, "step.setEnd"),
 			},
 		},
 		CurrentStepIndex: 0,
@@ -90,6 +128,25 @@ func setAlertEmpty(chatId int64) Process {
 	}
 }
 
+// stepData returns the data entered for the step with the given name.
+//
+// Parameters:
+//
+//	p (Process): The process.
+//	name (string): The name of the step.
+//
+// Returns:
+//
+//	string: The data of the step, or an empty string if the process has no such step.
+func stepData(p Process, name string) string {
+	for _, step := range p.Step {
+		if step.Name == name {
+			return step.Data
+		}
+	}
+	return ""
+}
+
 // setAlertOnComplete saves the completed "SET_ALERT" process to the database.
 //
 // Parameters:
@@ -100,7 +157,11 @@ func setAlertEmpty(chatId int64) Process {
 //
 //	error: An error if the operation fails, otherwise nil.
 func setAlertOnComplete(p Process) error {
-	interval, err := strconv.Atoi(p.Step[2].Data)
+	interval, err := strconv.Atoi(stepData(p, "interval"))
+	if err != nil {
+		return err
+	}
+	digestPeriod, digestStyle, err := parseDelivery(stepData(p, "delivery"))
 	if err != nil {
 		return err
 	}
@@ -108,21 +169,104 @@ func setAlertOnComplete(p Process) error {
 	return db.Update(func(txn *badger.Txn) error {
 		alert := Alert{
 			Id:              time.Now().UnixNano(),
-			Title:           p.Step[0].Data,
-			Link:            p.Step[1].Data,
+			Title:           stepData(p, "title"),
+			Link:            stepData(p, "link"),
 			Interval:        interval,
 			ChatId:          p.ChatId,
+			Bot:             p.Bot,
 			LastTimeChecked: time.Now().Unix(),
+			DigestPeriod:    digestPeriod,
+			DigestStyle:     digestStyle,
+			LastDigestAt:    time.Now().Unix(),
+			Include:         parseKeywords(stepData(p, "include")),
+			Exclude:         parseKeywords(stepData(p, "exclude")),
 		}
 
-		key := "alert-" + strconv.FormatInt(p.ChatId, 10) + "-" + strconv.FormatInt(alert.Id, 10)
+		return saveAlert(txn, alert)
+	})
+}
 
-		value, err := json.Marshal(alert)
-		if err != nil {
-			return err
-		}
-		return txn.Set([]byte(key), value)
+// editAlertEmpty initializes a new "EDIT_ALERT" process with predefined steps.
+//
+// Parameters:
+//
+//	chatId (int64): The ID of the chat for which the process is being created.
+//	lang (string): The language of the step messages.
+//
+// Returns:
+//
+//	Process: A new "EDIT_ALERT" process with predefined steps and metadata.
+func editAlertEmpty(chatId int64, lang string) Process {
+	fields := tr(lang, "step.editField")
+	for _, field := range alertFields {
+		fields += "\n" + field.Name + ": " + tr(lang, field.Description)
+	}
+
+	return Process{
+		Id: ProcessKey.EditAlert,
+		Step: []Step{
+			{
+				Name:    "alert",
+				Data:    "",
+				Message: tr(lang, "step.editAlert"),
+			},
+			{
+				Name:    "field",
+				Data:    "",
+				Message: fields,
+			},
+			{
+				Name:    "value",
+				Data:    "",
+				Message: tr(lang, "step.editValue"),
+			},
+			{
+				Name:    "end",
+				Data:    "",
+				Message: tr(lang, "step.editEnd"),
+			},
+		},
+		CurrentStepIndex: 0,
+		ChatId:           chatId,
+		LastActionAt:     time.Now().Unix(),
+	}
+}
+
+// editAlertOnComplete applies the change of a completed "EDIT_ALERT" process to the alert.
+// A new webhook secret is added to the final message, as it is not shown anywhere else.
+//
+// Parameters:
+//
+//	p (*Process): The completed process.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the entered data is invalid, another error if the operation fails, otherwise nil.
+func editAlertOnComplete(p *Process) error {
+	alerts, err := listAlerts(p.Bot, p.ChatId)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(stepData(*p, "alert")))
+	if err != nil || index < 1 || index > len(alerts) {
+		return &ProcessInputError{Key: "edit.alert.invalid"}
+	}
+	field, ok := findAlertField(strings.TrimSpace(stepData(*p, "field")))
+	if !ok {
+		return &ProcessInputError{Key: "edit.field.invalid"}
+	}
+
+	alert := alerts[index-1]
+	updated, err := updateAlert(alert.Bot, alert.ChatId, alert.Id, func(alert *Alert) error {
+		return field.Set(alert, strings.TrimSpace(stepData(*p, "value")))
 	})
+	if err != nil {
+		return err
+	}
+	if updated.WebhookSecret != alert.WebhookSecret {
+		p.Step[p.CurrentStepIndex].Message += "\n\n" + tr(chatLang(p.Bot, p.ChatId), "edit.webhookSecret.set", updated.WebhookSecret)
+	}
+	return nil
 }
 
 // preStartNewProcess prepares a new process by deleting previous processes
@@ -132,15 +276,16 @@ func setAlertOnComplete(p Process) error {
 //
 //	processKey (string): The key of the process to be started.
 //	chatId (int64): The ID of the chat for which the process is being started.
+//	botName (string): The name of the bot the process is started on.
 //	db (*badger.DB): The Badger database instance.
 //
 // Returns:
 //
 //	error: An error if the operation fails, otherwise nil.
-func preStartNewProcess(processKey string, chatId int64, db *badger.DB) error {
+func preStartNewProcess(processKey string, chatId int64, botName string, db *badger.DB) error {
 	// delete previous processes for this user
 	err := db.Update(func(txn *badger.Txn) error {
-		prefix := []byte(strconv.FormatInt(chatId, 10) + "-" + processKey)
+		prefix := []byte(chatScope(botName, chatId) + "-" + processKey)
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = false
 		it := txn.NewIterator(opts)
@@ -160,7 +305,7 @@ func preStartNewProcess(processKey string, chatId int64, db *badger.DB) error {
 
 	// set current process for this user
 	err = db.Update(func(txn *badger.Txn) error {
-		key := []byte(strconv.FormatInt(chatId, 10) + "-CURRENT_PROCESS")
+		key := []byte(chatScope(botName, chatId) + "-CURRENT_PROCESS")
 		value := []byte(processKey)
 		return txn.Set(key, value)
 	})
@@ -175,17 +320,19 @@ func preStartNewProcess(processKey string, chatId int64, db *badger.DB) error {
 //
 // Parameters:
 //
-//	p (Process): The completed process.
+//	p (*Process): The completed process, whose final message may be extended.
 //	db (*badger.DB): The Badger database instance.
 //
 // Returns:
 //
 //	error: An error if the operation fails, otherwise nil.
-func processOnComplete(p Process, db *badger.DB) error {
+func processOnComplete(p *Process, db *badger.DB) error {
 	var err error
 	switch p.Id {
 	case ProcessKey.SetAlert:
-		err = setAlertOnComplete(p)
+		err = setAlertOnComplete(*p)
+	case ProcessKey.EditAlert:
+		err = editAlertOnComplete(p)
 	default:
 		return nil
 	}
@@ -194,9 +341,23 @@ func processOnComplete(p Process, db *badger.DB) error {
 		return err
 	}
 
+	return processCleanUp(*p, db)
+}
+
+// processCleanUp deletes the keys of a finished process, so the user is no longer in it.
+//
+// Parameters:
+//
+//	p (Process): The finished process.
+//	db (*badger.DB): The Badger database instance.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func processCleanUp(p Process, db *badger.DB) error {
 	// delete current process key
-	err = db.Update(func(txn *badger.Txn) error {
-		key := []byte(strconv.FormatInt(p.ChatId, 10) + "-CURRENT_PROCESS")
+	err := db.Update(func(txn *badger.Txn) error {
+		key := []byte(chatScope(p.Bot, p.ChatId) + "-CURRENT_PROCESS")
 		return txn.Delete(key)
 	})
 	if err != nil {
@@ -204,7 +365,7 @@ func processOnComplete(p Process, db *badger.DB) error {
 	}
 	// delete process key
 	err = db.Update(func(txn *badger.Txn) error {
-		processKey := []byte(strconv.FormatInt(p.ChatId, 10) + "-" + p.Id)
+		processKey := []byte(chatScope(p.Bot, p.ChatId) + "-" + p.Id)
 		return txn.Delete(processKey)
 	})
 	if err != nil {
@@ -220,32 +381,37 @@ func processOnComplete(p Process, db *badger.DB) error {
 //
 //	key (string): The key of the process to be started.
 //	chatId (int64): The ID of the chat for which the process is being started.
+//	botName (string): The name of the bot the process is started on.
+//	lang (string): The language of the step messages.
 //	db (*badger.DB): The Badger database instance.
 //
 // Returns:
 //
 //	Process: The initialized process.
 //	error: An error if the operation fails, otherwise nil.
-func ProcessStart(key string, chatId int64, db *badger.DB) (Process, error) {
+func ProcessStart(key string, chatId int64, botName string, lang string, db *badger.DB) (Process, error) {
 	var p Process
 	var err error
 
 	// pre-start new process
-	err = preStartNewProcess(key, chatId, db)
+	err = preStartNewProcess(key, chatId, botName, db)
 	if err != nil {
 		return Process{}, err
 	}
 
 	switch key {
 	case ProcessKey.SetAlert:
-		p = setAlertEmpty(chatId)
+		p = setAlertEmpty(chatId, lang)
+	case ProcessKey.EditAlert:
+		p = editAlertEmpty(chatId, lang)
 	default:
 		return Process{}, nil
 	}
+	p.Bot = botName
 
 	// save process struct as json string to db
 	err = db.Update(func(txn *badger.Txn) error {
-		userProcessKey := []byte(strconv.FormatInt(chatId, 10) + "-" + key)
+		userProcessKey := []byte(chatScope(botName, chatId) + "-" + key)
 		value, err := json.Marshal(p)
 		if err != nil {
 			return err
@@ -261,6 +427,7 @@ func ProcessStart(key string, chatId int64, db *badger.DB) (Process, error) {
 
 // ProcessGoNextStep advances the process to the next step, saves the updated process,
 // and optionally calls the onComplete function if the process is completed.
+// A process whose onComplete function fails is ended.
 //
 // Parameters:
 //
@@ -282,7 +449,7 @@ func ProcessGoNextStep(p Process, userInput string, db *badger.DB) (Process, err
 
 		// save process struct as json string to db
 		err = db.Update(func(txn *badger.Txn) error {
-			userProcessKey := []byte(strconv.FormatInt(p.ChatId, 10) + "-" + p.Id)
+			userProcessKey := []byte(chatScope(p.Bot, p.ChatId) + "-" + p.Id)
 			value, err := json.Marshal(p)
 			if err != nil {
 				return err
@@ -294,8 +461,12 @@ func ProcessGoNextStep(p Process, userInput string, db *badger.DB) (Process, err
 		}
 
 		if p.CurrentStepIndex == len(p.Step)-1 {
-			err = processOnComplete(p, db)
+			err = processOnComplete(&p, db)
 			if err != nil {
+				// the process cannot go back from its last step, so it has to be started again
+				if cleanUpErr := processCleanUp(p, db); cleanUpErr != nil {
+					return Process{}, cleanUpErr
+				}
 				return Process{}, err
 			}
 		}
@@ -311,6 +482,7 @@ func ProcessGoNextStep(p Process, userInput string, db *badger.DB) (Process, err
 // Parameters:
 //
 //	chatId (int64): The ID of the chat.
+//	botName (string): The name of the bot of the chat.
 //	db (*badger.DB): The Badger database instance.
 //
 // Returns:
@@ -318,10 +490,10 @@ func ProcessGoNextStep(p Process, userInput string, db *badger.DB) (Process, err
 //	string: The key of the current process.
 //	Process: The current process.
 //	error: An error if the operation fails, otherwise nil.
-func CurrentProcess(chatId int64, db *badger.DB) (string, Process, error) {
+func CurrentProcess(chatId int64, botName string, db *badger.DB) (string, Process, error) {
 	var processKey string
 	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(strconv.FormatInt(chatId, 10) + "-CURRENT_PROCESS"))
+		item, err := txn.Get([]byte(chatScope(botName, chatId) + "-CURRENT_PROCESS"))
 		if err != nil {
 			return err
 		}
@@ -336,7 +508,7 @@ func CurrentProcess(chatId int64, db *badger.DB) (string, Process, error) {
 
 	var p Process
 	err = db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(strconv.FormatInt(chatId, 10) + "-" + processKey))
+		item, err := txn.Get([]byte(chatScope(botName, chatId) + "-" + processKey))
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// tehran is the timezone in which quiet hours are interpreted.
+var tehran = loadTehran()
+
+// loadTehran loads the Asia/Tehran timezone, falling back to its fixed offset.
+//
+// Returns:
+//
+//	*time.Location: The Tehran timezone.
+func loadTehran() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		return time.FixedZone("IRST", 3*60*60+30*60)
+	}
+	return loc
+}
+
+// parseClock parses a time of day in "HH:MM" format.
+//
+// Parameters:
+//
+//	clock (string): The time of day, e.g. "23:30".
+//
+// Returns:
+//
+//	int: The number of minutes since midnight.
+//	error: An error if the format is invalid, otherwise nil.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inQuietHours reports whether the given moment falls into the quiet hours of a chat.
+// Quiet hours may span midnight, e.g. from 23:00 to 07:00.
+//
+// Parameters:
+//
+//	chat (Chat): The settings of the chat.
+//	now (time.Time): The moment to check.
+//
+// Returns:
+//
+//	bool: True if notifications should be deferred, otherwise false.
+func inQuietHours(chat Chat, now time.Time) bool {
+	if chat.QuietStart == "" || chat.QuietEnd == "" {
+		return false
+	}
+	start, err := parseClock(chat.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(chat.QuietEnd)
+	if err != nil {
+		return false
+	}
+
+	now = now.In(tehran)
+	minute := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// deferPost queues a new post to be delivered once the quiet hours of the chat are over.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The new post.
+//
+// Returns:
+//
+//	string: The key of the queued post.
+//	error: An error if the operation fails, otherwise nil.
+func deferPost(txn *badger.Txn, alert Alert, post divar.PostWidget) (string, error) {
+	return deferPostWithNote(txn, alert, post, "")
+}
+
+// deferPostWithNote queues a post to be delivered once the quiet hours of the chat are over,
+// with a note that says why it is sent, e.g. the price change of a tracked post.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that matched the post.
+//	post (divar.PostWidget): The post.
+//	note (string): The note shown under the title of the post, empty for none.
+//
+// Returns:
+//
+//	string: The key of the queued post.
+//	error: An error if the operation fails, otherwise nil.
+func deferPostWithNote(txn *badger.Txn, alert Alert, post divar.PostWidget, note string) (string, error) {
+	value, err := json.Marshal(DeferredPost{
+		Bot:        alert.Bot,
+		AlertId:    alert.Id,
+		AlertTitle: alert.Title,
+		Post:       post,
+		Note:       note,
+	})
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("deferred-%s-%d", chatScope(alert.Bot, alert.ChatId), time.Now().UnixNano())
+	return key, txn.Set([]byte(key), value)
+}
+
+// deliverDeferredPosts sends the posts queued during quiet hours as list messages
+// to every chat whose quiet hours are over. Posts are removed from the queue only
+// after the message containing them has been sent.
+func deliverDeferredPosts() {
+	queue, err := readQueue("deferred-")
+	if err != nil {
+		sugar.Errorw("Failed to read deferred posts", "error", err)
+		return
+	}
+
+	// posts are grouped per chat and per bot, as each bot delivers its own alerts
+	type destination struct {
+		bot    string
+		chatId int64
+	}
+	var destinations []destination
+	queues := map[destination][]queuedPost{}
+	for _, q := range queue {
+		name, chatId, _, ok := parseChatScope(strings.TrimPrefix(string(q.key), "deferred-"))
+		if !ok {
+			sugar.Errorw("Invalid deferred post key", "key", string(q.key))
+			continue
+		}
+		d := destination{bot: name, chatId: chatId}
+		if _, ok := queues[d]; !ok {
+			destinations = append(destinations, d)
+		}
+		queues[d] = append(queues[d], q)
+	}
+
+	for _, d := range destinations {
+		instance, ok := findBot(d.bot)
+		if !ok {
+			sugar.Errorw("Dropping deferred posts of a bot that is not configured", "bot", d.bot, "chat", d.chatId)
+			if err := removeQueued(queues[d]); err != nil {
+				sugar.Errorw("Failed to remove deferred posts", "error", err, "chat", d.chatId)
+			}
+			continue
+		}
+
+		var chat Chat
+		err := db.View(func(txn *badger.Txn) error {
+			var err error
+			chat, err = getChat(txn, d.bot, d.chatId)
+			return err
+		})
+		if err != nil {
+			sugar.Errorw("Failed to read chat settings", "error", err, "chat", d.chatId)
+			continue
+		}
+		prefix := fmt.Sprintf("deferred-%s-", chatScope(d.bot, d.chatId))
+		if inQuietHours(chat, time.Now()) || !queueDue(prefix) {
+			continue
+		}
+
+		if err := sendQueuedList(instance, d.chatId, tr(chat.Lang, "quiet.header"), queues[d], true); err != nil {
+			queueFailed(prefix, queues[d], err)
+			continue
+		}
+		queueDelivered(prefix)
+	}
+}
+
+func handlerQuiet(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	args := commandArgs(update.Message.Text)
+
+	var start, end string
+	if args != "off" {
+		var ok bool
+		start, end, ok = strings.Cut(args, "-")
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+		_, startErr := parseClock(start)
+		_, endErr := parseClock(end)
+		if !ok || startErr != nil || endErr != nil || start == end {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatId,
+				Text:   tr(lang, "quiet.usage"),
+			})
+			return
+		}
+	}
+
+	_, err := updateChat(botName(b), chatId, func(chat *Chat) {
+		chat.QuietStart = start
+		chat.QuietEnd = end
+	})
+	if err != nil {
+		sugar.Errorw("Failed to set quiet hours", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "quiet.error"),
+		})
+		return
+	}
+
+	text := tr(lang, "quiet.off")
+	if start != "" {
+		text = tr(lang, "quiet.on", start, end)
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatId,
+		Text:   text,
+	})
+}
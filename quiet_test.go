@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		clock string
+		want  int
+		ok    bool
+	}{
+		{"00:00", 0, true},
+		{"07:30", 450, true},
+		{"23:59", 1439, true},
+		{"7:30", 450, true},
+		{"7pm", 0, false},
+		{"24:00", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseClock(test.clock)
+		if ok := err == nil; ok != test.ok || got != test.want {
+			t.Errorf("parseClock(%q) = %d, %v, want %d, ok %v", test.clock, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	// Tehran is 3:30 ahead of UTC
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		now   time.Time
+		want  bool
+	}{
+		{"disabled", "", "", at(0, 0), false},
+		{"invalid", "23:00", "7am", at(0, 0), false},
+		{"inside the day", "09:00", "17:00", at(8, 0), true},
+		{"before the day", "09:00", "17:00", at(5, 29), false},
+		{"at the start", "09:00", "17:00", at(5, 30), true},
+		{"at the end", "09:00", "17:00", at(13, 30), false},
+		{"over midnight, evening", "23:00", "07:00", at(19, 30), true},
+		{"over midnight, before the start", "23:00", "07:00", at(19, 29), false},
+		// 21:00 UTC is already the next day in Tehran
+		{"over midnight, after midnight in Tehran", "23:00", "07:00", at(21, 0), true},
+		{"over midnight, morning", "23:00", "07:00", at(3, 29), true},
+		{"over midnight, at the end", "23:00", "07:00", at(3, 30), false},
+		{"midnight in UTC", "02:00", "05:00", at(0, 0), true},
+		{"same start and end", "07:00", "07:00", at(3, 30), false},
+	}
+	for _, test := range tests {
+		chat := Chat{QuietStart: test.start, QuietEnd: test.end}
+		if got := inQuietHours(chat, test.now); got != test.want {
+			t.Errorf("%s: inQuietHours(%s-%s, %s) = %v, want %v", test.name, test.start, test.end, test.now.In(tehran).Format("15:04"), got, test.want)
+		}
+	}
+}
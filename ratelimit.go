@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-telegram/bot"
+	"sync"
+	"time"
+)
+
+// globalSendRate is the number of messages per second a bot may send in total.
+const globalSendRate = 30
+
+// chatSendRate is the number of messages per second a bot may send to a single chat.
+const chatSendRate = 1
+
+// tokenBucket is a token bucket that refills continuously at a fixed rate.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket.
+//
+// Parameters:
+//
+//	rate (float64): The number of tokens added per second.
+//	burst (float64): The capacity of the bucket.
+//	now (time.Time): The current time.
+//
+// Returns:
+//
+//	*tokenBucket: The new token bucket.
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// delay returns how long to wait until a token is available.
+//
+// Parameters:
+//
+//	now (time.Time): The current time.
+//
+// Returns:
+//
+//	time.Duration: The time until a token is available, 0 if one is available now.
+func (t *tokenBucket) delay(now time.Time) time.Duration {
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	if t.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
+
+// sendLimiter enforces the global and per-chat send rates of the bot API,
+// and pauses sending when the API asks to retry later.
+type sendLimiter struct {
+	mu         sync.Mutex
+	chatRate   float64
+	global     *tokenBucket
+	chats      map[int64]*tokenBucket
+	floodUntil time.Time
+	now        func() time.Time // the clock, replaced in tests
+}
+
+// newSendLimiter creates a send limiter.
+//
+// Parameters:
+//
+//	globalRate (float64): The number of messages per second allowed in total.
+//	chatRate (float64): The number of messages per second allowed per chat.
+//
+// Returns:
+//
+//	*sendLimiter: The new send limiter.
+func newSendLimiter(globalRate float64, chatRate float64) *sendLimiter {
+	return &sendLimiter{
+		chatRate: chatRate,
+		global:   newTokenBucket(globalRate, globalRate, time.Now()),
+		chats:    map[int64]*tokenBucket{},
+		now:      time.Now,
+	}
+}
+
+// delay returns how long to wait until a message can be sent to the chat.
+// The caller must hold the lock.
+//
+// Parameters:
+//
+//	chatId (int64): The ID of the chat.
+//	now (time.Time): The current time.
+//
+// Returns:
+//
+//	time.Duration: The time until a message can be sent, 0 if it can be sent now.
+func (l *sendLimiter) delay(chatId int64, now time.Time) time.Duration {
+	chat, ok := l.chats[chatId]
+	if !ok {
+		chat = newTokenBucket(l.chatRate, 1, now)
+		l.chats[chatId] = chat
+	}
+	return max(l.floodUntil.Sub(now), l.global.delay(now), chat.delay(now))
+}
+
+// Ready reports whether a message can be sent to the chat without waiting.
+//
+// Parameters:
+//
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	bool: True if a message can be sent now, otherwise false.
+func (l *sendLimiter) Ready(chatId int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.delay(chatId, l.now()) <= 0
+}
+
+// Wait blocks until a message can be sent to the chat and takes its tokens.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context that cancels the wait.
+//	chatId (int64): The ID of the chat.
+//
+// Returns:
+//
+//	error: The error of the context if it is done before a message can be sent, otherwise nil.
+func (l *sendLimiter) Wait(ctx context.Context, chatId int64) error {
+	for {
+		l.mu.Lock()
+		now := l.now()
+		d := l.delay(chatId, now)
+		if d <= 0 {
+			l.global.tokens--
+			l.chats[chatId].tokens--
+			l.forgetIdleChats(now)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// forgetIdleChats drops the buckets of chats that have been idle long enough to be full again.
+// The caller must hold the lock.
+//
+// Parameters:
+//
+//	now (time.Time): The current time.
+func (l *sendLimiter) forgetIdleChats(now time.Time) {
+	if len(l.chats) < 1000 {
+		return
+	}
+	for chatId, chat := range l.chats {
+		if now.Sub(chat.last).Seconds()*chat.rate >= chat.burst {
+			delete(l.chats, chatId)
+		}
+	}
+}
+
+// Observe inspects the error of a send and pauses all sending when the API
+// answered with 429 Too Many Requests.
+//
+// Parameters:
+//
+//	err (error): The error returned by the send.
+//
+// Returns:
+//
+//	time.Duration: The pause requested by the API, 0 if the error is not a flood wait.
+func (l *sendLimiter) Observe(err error) time.Duration {
+	var tooMany *bot.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		return 0
+	}
+	retryAfter := time.Duration(max(tooMany.RetryAfter, 1)) * time.Second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(retryAfter); until.After(l.floodUntil) {
+		l.floodUntil = until
+	}
+	return retryAfter
+}
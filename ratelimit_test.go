@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"testing"
+	"time"
+)
+
+// testLimiter creates a send limiter whose clock only moves when the test advances it.
+func testLimiter(globalRate float64, chatRate float64) (*sendLimiter, func(time.Duration)) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newSendLimiter(globalRate, chatRate)
+	limiter.now = func() time.Time { return now }
+	limiter.global = newTokenBucket(globalRate, globalRate, now)
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	bucket := newTokenBucket(2, 2, start)
+	for i := 0; i < 2; i++ {
+		if d := bucket.delay(start); d != 0 {
+			t.Fatalf("token %d waits %v in a full bucket", i+1, d)
+		}
+		bucket.tokens--
+	}
+	if d := bucket.delay(start); d != 500*time.Millisecond {
+		t.Errorf("empty bucket waits %v, want 500ms at 2 tokens per second", d)
+	}
+	if d := bucket.delay(start.Add(250 * time.Millisecond)); d != 250*time.Millisecond {
+		t.Errorf("half refilled token waits %v, want 250ms", d)
+	}
+	if d := bucket.delay(start.Add(time.Hour)); d != 0 || bucket.tokens != bucket.burst {
+		t.Errorf("after an hour the bucket holds %v tokens and waits %v, want it full", bucket.tokens, d)
+	}
+}
+
+func TestSendLimiterChatRate(t *testing.T) {
+	limiter, advance := testLimiter(30, 1)
+	if err := limiter.Wait(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.Ready(1) {
+		t.Error("a second message to the chat is ready within the same second")
+	}
+	if !limiter.Ready(2) {
+		t.Error("another chat waits for the first one")
+	}
+	advance(time.Second)
+	if !limiter.Ready(1) {
+		t.Error("the chat is not ready a second later")
+	}
+}
+
+func TestSendLimiterGlobalRate(t *testing.T) {
+	limiter, advance := testLimiter(3, 1)
+	for chatId := int64(1); chatId <= 3; chatId++ {
+		if err := limiter.Wait(context.Background(), chatId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if limiter.Ready(4) {
+		t.Error("a fourth message is ready within the same second at 3 messages per second")
+	}
+	advance(time.Second / 3)
+	if !limiter.Ready(4) {
+		t.Error("the global bucket did not refill")
+	}
+}
+
+func TestSendLimiterObserve(t *testing.T) {
+	limiter, advance := testLimiter(30, 1)
+	if d := limiter.Observe(errors.New("bad request")); d != 0 {
+		t.Errorf("Observe() of another error = %v, want 0", d)
+	}
+	if !limiter.Ready(1) {
+		t.Fatal("another error paused sending")
+	}
+
+	err := fmt.Errorf("send: %w", &bot.TooManyRequestsError{Message: "Too Many Requests", RetryAfter: 5})
+	if d := limiter.Observe(err); d != 5*time.Second {
+		t.Errorf("Observe() = %v, want the 5s asked by the API", d)
+	}
+	// a shorter pause does not shorten the current one
+	limiter.Observe(&bot.TooManyRequestsError{RetryAfter: 1})
+	advance(4 * time.Second)
+	if limiter.Ready(2) {
+		t.Error("sending resumed before the retry-after delay")
+	}
+	advance(time.Second)
+	if !limiter.Ready(2) {
+		t.Error("sending did not resume after the retry-after delay")
+	}
+
+	if d := limiter.Observe(&bot.TooManyRequestsError{}); d != time.Second {
+		t.Errorf("Observe() without a delay = %v, want at least 1s", d)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// repostTTL is how long the fingerprints of posts and the IDs of their messages are kept.
+const repostTTL = 60 * 24 * time.Hour
+
+// RepostMode holds the ways an alert can handle reposts of earlier posts.
+//
+// Fields:
+//
+//	Off (string): Reposts are sent as new posts.
+//	Tag (string): Reposts are sent tagged as "آگهی تکراری", replying to the earlier notification.
+//	Hide (string): Reposts are not sent.
+var RepostMode = struct {
+	Off  string
+	Tag  string
+	Hide string
+}{
+	Off:  "",
+	Tag:  "tag",
+	Hide: "hide",
+}
+
+// RepostEntry records the latest post of a chat with a fingerprint.
+//
+// Fields:
+//
+//	Token (string): The token of the post.
+//	SeenAt (int64): The timestamp at which the post was found.
+type RepostEntry struct {
+	Token  string `json:"token"`
+	SeenAt int64  `json:"seenAt"`
+}
+
+// postFingerprints returns the fingerprints under which a post is recognized when it is
+// posted again with a new token: its text with the price, and its image.
+//
+// Parameters:
+//
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	[]string: The fingerprints of the post.
+func postFingerprints(post divar.PostWidget) []string {
+	var fingerprints []string
+	if title := normalizeKeywordText(post.Data.Title); title != "" {
+		// the bottom description holds the time and place of the post, which change on repost
+		text := strings.Join([]string{
+			title,
+			normalizeKeywordText(post.Data.TopDescriptionText),
+			normalizeKeywordText(post.Data.MiddleDescriptionText),
+			postPrice(post),
+		}, "|")
+		sum := sha256.Sum256([]byte(text))
+		fingerprints = append(fingerprints, "text-"+hex.EncodeToString(sum[:16]))
+	}
+	if u, err := url.Parse(post.Data.ImageURL); err == nil && u.Path != "" {
+		sum := sha256.Sum256([]byte(u.Host + u.Path))
+		fingerprints = append(fingerprints, "image-"+hex.EncodeToString(sum[:16]))
+	}
+	return fingerprints
+}
+
+// repostKey builds the database key of a post fingerprint of a chat.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot of the chat.
+//	chatId (int64): The ID of the chat.
+//	fingerprint (string): The fingerprint.
+//
+// Returns:
+//
+//	[]byte: The database key of the fingerprint.
+func repostKey(botName string, chatId int64, fingerprint string) []byte {
+	return []byte(fmt.Sprintf("repost-%s-%s", chatScope(botName, chatId), fingerprint))
+}
+
+// findRepost looks up whether the chat of an alert already got a post with the same
+// fingerprint under another token. Hiding a post drops it for good, so in the hide mode
+// both the text and the image of the post must match the same earlier post.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that found the post.
+//	post (divar.PostWidget): The new post.
+//
+// Returns:
+//
+//	string: The token of the earlier post, or an empty string if the post is not a repost.
+//	error: An error if the operation fails, otherwise nil.
+func findRepost(txn *badger.Txn, alert Alert, post divar.PostWidget) (string, error) {
+	fingerprints := postFingerprints(post)
+	if alert.Reposts == RepostMode.Off || (alert.Reposts == RepostMode.Hide && len(fingerprints) < 2) {
+		return "", nil
+	}
+	var tokens []string
+	for _, fingerprint := range fingerprints {
+		item, err := txn.Get(repostKey(alert.Bot, alert.ChatId, fingerprint))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			tokens = append(tokens, "")
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		var entry RepostEntry
+		err = item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &entry)
+		})
+		if err != nil {
+			return "", err
+		}
+		if entry.Token == post.Data.Token {
+			entry.Token = ""
+		}
+		tokens = append(tokens, entry.Token)
+	}
+
+	if alert.Reposts == RepostMode.Hide {
+		for _, token := range tokens {
+			if token != tokens[0] {
+				return "", nil
+			}
+		}
+		return tokens[0], nil
+	}
+	for _, token := range tokens {
+		if token != "" {
+			return token, nil
+		}
+	}
+	return "", nil
+}
+
+// recordRepost records the fingerprints of a post the chat of an alert got, so later
+// reposts of it are recognized. Posts the chat never got are not recorded, or their
+// reposts would be hidden or tagged as well.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that found the post.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func recordRepost(txn *badger.Txn, alert Alert, post divar.PostWidget) error {
+	value, err := json.Marshal(RepostEntry{Token: post.Data.Token, SeenAt: time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+	for _, fingerprint := range postFingerprints(post) {
+		if err := txn.SetEntry(badger.NewEntry(repostKey(alert.Bot, alert.ChatId, fingerprint), value).WithTTL(repostTTL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageKey builds the database key under which the ID of the notification message of a post is stored.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot that sent the message.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the message ID.
+func messageKey(botName string, chatId int64, token string) []byte {
+	return []byte(fmt.Sprintf("message-%s-%s", chatScope(botName, chatId), token))
+}
+
+// rememberMessage stores the ID of the notification message of a post, so a repost can reply to it.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot that sent the message.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//	messageId (int): The ID of the message.
+func rememberMessage(botName string, chatId int64, token string, messageId int) {
+	err := db.Update(func(txn *badger.Txn) error {
+		value := binary.BigEndian.AppendUint64(nil, uint64(messageId))
+		return txn.SetEntry(badger.NewEntry(messageKey(botName, chatId, token), value).WithTTL(repostTTL))
+	})
+	if err != nil {
+		sugar.Errorw("Failed to save message ID", "error", err, "token", token)
+	}
+}
+
+// sentMessageId returns the ID of the notification message of a post.
+//
+// Parameters:
+//
+//	botName (string): The name of the bot that sent the message.
+//	chatId (int64): The ID of the chat.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	int: The ID of the message, or 0 if it is not known.
+func sentMessageId(botName string, chatId int64, token string) int {
+	var messageId int
+	db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(messageKey(botName, chatId, token))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if len(val) == 8 {
+				messageId = int(binary.BigEndian.Uint64(val))
+			}
+			return nil
+		})
+	})
+	return messageId
+}
+
+// setAlertReposts sets how an alert handles reposts of earlier posts.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): "tag", "hide", or "off" to send reposts as new posts.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the value is not one of them, otherwise nil.
+func setAlertReposts(alert *Alert, value string) error {
+	switch strings.ToLower(value) {
+	case "off":
+		alert.Reposts = RepostMode.Off
+	case RepostMode.Tag:
+		alert.Reposts = RepostMode.Tag
+	case RepostMode.Hide:
+		alert.Reposts = RepostMode.Hide
+	default:
+		return &ProcessInputError{Key: "edit.reposts.invalid"}
+	}
+	return nil
+}
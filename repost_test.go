@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+)
+
+// repostTestPost builds a post with the given text and image.
+func repostTestPost(token string, title string, image string) divar.PostWidget {
+	post := testPost(token, title)
+	post.Data.MiddleDescriptionText = "۸۰۰٬۰۰۰٬۰۰۰ تومان"
+	if image != "" {
+		post.Data.ImageURL = "https://example.com/" + image + ".jpg"
+	}
+	return post
+}
+
+func TestFindRepost(t *testing.T) {
+	openTestDB(t)
+	earlier := repostTestPost("a", "flat", "photo")
+	tests := []struct {
+		name string
+		mode string
+		post divar.PostWidget
+		want string
+	}{
+		{"same text and image", RepostMode.Hide, repostTestPost("b", "flat", "photo"), "a"},
+		{"same text only", RepostMode.Hide, repostTestPost("b", "flat", "other"), ""},
+		{"same image only", RepostMode.Hide, repostTestPost("b", "house", "photo"), ""},
+		{"same text without image", RepostMode.Hide, repostTestPost("b", "flat", ""), ""},
+		{"same text only", RepostMode.Tag, repostTestPost("b", "flat", "other"), "a"},
+		{"same image only", RepostMode.Tag, repostTestPost("b", "house", "photo"), "a"},
+		{"different post", RepostMode.Tag, repostTestPost("b", "house", "other"), ""},
+		{"same token", RepostMode.Tag, earlier, ""},
+		{"off", RepostMode.Off, repostTestPost("b", "flat", "photo"), ""},
+	}
+	err := db.Update(func(txn *badger.Txn) error {
+		if err := recordRepost(txn, Alert{ChatId: 10, Bot: "telegram"}, earlier); err != nil {
+			return err
+		}
+		for _, test := range tests {
+			got, err := findRepost(txn, Alert{ChatId: 10, Bot: "telegram", Reposts: test.mode}, test.post)
+			if err != nil {
+				return err
+			}
+			if got != test.want {
+				t.Errorf("%s in mode %q: findRepost() = %q, want %q", test.name, test.mode, got, test.want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckAlertsRecordsRepostsOfNotifiedPostsOnly(t *testing.T) {
+	openTestDB(t)
+	setTestBots(t, "telegram")
+	// the first alert does not notify the post, so its repost is not hidden from the second
+	saveTestAlert(t, Alert{Id: 1, ChatId: 10, Bot: "telegram", Title: "houses", Link: "houses-link", Reposts: RepostMode.Hide, Include: []string{"house"}})
+	saveTestAlert(t, Alert{Id: 2, ChatId: 10, Bot: "telegram", Title: "flats", Link: "flats-link", Reposts: RepostMode.Hide})
+
+	results := map[string][]divar.PostWidget{
+		"houses-link": {repostTestPost("a", "flat", "photo")},
+		"flats-link":  {repostTestPost("b", "flat", "photo")},
+	}
+	search := func(link string) (divar.SearchRes, error) {
+		return divar.SearchRes{ListWidgets: results[link]}, nil
+	}
+	checkAlerts(search, map[string]Notifier{Channel.Bot: &recordingNotifier{}})
+
+	items, err := readOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Post.Data.Token != "b" {
+		t.Errorf("outbox holds %+v, want the post of the second alert", items)
+	}
+}
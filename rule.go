@@ -0,0 +1,481 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ruleSuffixes holds the multipliers of the number suffixes of rules, e.g. "300m".
+var ruleSuffixes = map[byte]float64{
+	'k': 1e3,
+	'm': 1e6,
+	'b': 1e9,
+}
+
+// errRuleDivisionByZero is returned when a rule divides by zero.
+var errRuleDivisionByZero = errors.New("division by zero")
+
+// errRuleMissingValue is returned when a rule uses a value the post does not give, e.g. the area of a post without one.
+var errRuleMissingValue = errors.New("missing value")
+
+// ruleVariableNames holds the names of the values that rules can use.
+var ruleVariableNames = []string{"price", "deposit", "rent", "area"}
+
+// ruleVariables returns the values of a post that rules can use. Values the post
+// does not give are left out, so a rule using them fails instead of seeing 0.
+//
+// Parameters:
+//
+//	attributes (divar.PostAttributes): The parsed attributes of the post.
+//
+// Returns:
+//
+//	map[string]float64: The values by variable name.
+func ruleVariables(attributes divar.PostAttributes) map[string]float64 {
+	vars := map[string]float64{}
+	if attributes.Price > 0 || attributes.PriceKind == divar.PriceKind.Free {
+		vars["price"] = float64(attributes.Price)
+	}
+	if attributes.Deposit > 0 {
+		vars["deposit"] = float64(attributes.Deposit)
+	}
+	if attributes.Rent > 0 {
+		vars["rent"] = float64(attributes.Rent)
+	}
+	if attributes.Area > 0 {
+		vars["area"] = float64(attributes.Area)
+	}
+	return vars
+}
+
+// ruleNode is a compiled part of a rule.
+//
+// Fields:
+//
+//	Eval (func(map[string]float64) (float64, error)): Computes the value; booleans are 1 or 0.
+//	Bool (bool): Whether the value is a boolean.
+type ruleNode struct {
+	Eval func(vars map[string]float64) (float64, error)
+	Bool bool
+}
+
+// ruleParser compiles a rule with recursive descent over its tokens.
+type ruleParser struct {
+	tokens []string
+	pos    int
+}
+
+// compileRule compiles a rule expression, such as "price/area < 80_000_000" or
+// "deposit >= 300m && rent <= 10m".
+//
+// Parameters:
+//
+//	expression (string): The rule.
+//
+// Returns:
+//
+//	ruleNode: The compiled boolean rule.
+//	error: An error if the rule is invalid, otherwise nil.
+func compileRule(expression string) (ruleNode, error) {
+	tokens, err := tokenizeRule(expression)
+	if err != nil {
+		return ruleNode{}, err
+	}
+	p := &ruleParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return ruleNode{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return ruleNode{}, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if !node.Bool {
+		return ruleNode{}, errors.New("the rule must be a comparison")
+	}
+	return node, nil
+}
+
+// tokenizeRule splits a rule into numbers, names, operators and parentheses.
+//
+// Parameters:
+//
+//	expression (string): The rule.
+//
+// Returns:
+//
+//	[]string: The tokens.
+//	error: An error if the rule contains an unknown character, otherwise nil.
+func tokenizeRule(expression string) ([]string, error) {
+	var tokens []string
+	s := divar.NormalizeDigits(expression)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == '_' || s[j] == ',') {
+				j++
+			}
+			if j < len(s) && ruleSuffixes[s[j]] != 0 && (j+1 == len(s) || !isRuleNameByte(s[j+1])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case isRuleNameByte(c):
+			j := i
+			for j < len(s) && isRuleNameByte(s[j]) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||") ||
+			strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">=") ||
+			strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.IndexByte("+-*/<>!()", c) >= 0:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", s[i:i+1])
+		}
+	}
+	return tokens, nil
+}
+
+// isRuleNameByte reports whether a byte can be part of a variable name.
+func isRuleNameByte(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || c == '_')
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *ruleParser) parseOr() (ruleNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right ruleNode
+		if right, err = p.parseAnd(); err == nil {
+			left, err = logicalNode("||", left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseAnd() (ruleNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right ruleNode
+		if right, err = p.parseNot(); err == nil {
+			left, err = logicalNode("&&", left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseNot() (ruleNode, error) {
+	if p.peek() != "!" {
+		return p.parseComparison()
+	}
+	p.next()
+	operand, err := p.parseNot()
+	if err != nil {
+		return ruleNode{}, err
+	}
+	if !operand.Bool {
+		return ruleNode{}, errors.New("! needs a comparison")
+	}
+	return ruleNode{Bool: true, Eval: func(vars map[string]float64) (float64, error) {
+		value, err := operand.Eval(vars)
+		return boolValue(value == 0), err
+	}}, nil
+}
+
+func (p *ruleParser) parseComparison() (ruleNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return ruleNode{}, err
+	}
+	operator := p.peek()
+	compare, ok := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+	}[operator]
+	if !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseSum()
+	if err != nil {
+		return ruleNode{}, err
+	}
+	if left.Bool || right.Bool {
+		return ruleNode{}, fmt.Errorf("%s needs numbers", operator)
+	}
+	return ruleNode{Bool: true, Eval: func(vars map[string]float64) (float64, error) {
+		a, err := left.Eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		b, err := right.Eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		return boolValue(compare(a, b)), nil
+	}}, nil
+}
+
+func (p *ruleParser) parseSum() (ruleNode, error) {
+	left, err := p.parseProduct()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		operator := p.next()
+		var right ruleNode
+		if right, err = p.parseProduct(); err == nil {
+			left, err = arithmeticNode(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseProduct() (ruleNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/") {
+		operator := p.next()
+		var right ruleNode
+		if right, err = p.parseUnary(); err == nil {
+			left, err = arithmeticNode(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseUnary() (ruleNode, error) {
+	if p.peek() != "-" {
+		return p.parsePrimary()
+	}
+	p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return ruleNode{}, err
+	}
+	return arithmeticNode("-", ruleNode{Eval: func(map[string]float64) (float64, error) { return 0, nil }}, operand)
+}
+
+func (p *ruleParser) parsePrimary() (ruleNode, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return ruleNode{}, errors.New("unexpected end of rule")
+	case token == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return ruleNode{}, err
+		}
+		if p.next() != ")" {
+			return ruleNode{}, errors.New("missing )")
+		}
+		return node, nil
+	case token[0] >= '0' && token[0] <= '9' || token[0] == '.':
+		value, err := parseRuleNumber(token)
+		if err != nil {
+			return ruleNode{}, err
+		}
+		return ruleNode{Eval: func(map[string]float64) (float64, error) { return value, nil }}, nil
+	case isRuleNameByte(token[0]):
+		name := strings.ToLower(token)
+		if !slices.Contains(ruleVariableNames, name) {
+			return ruleNode{}, fmt.Errorf("unknown name %q", token)
+		}
+		return ruleNode{Eval: func(vars map[string]float64) (float64, error) {
+			value, ok := vars[name]
+			if !ok {
+				return 0, fmt.Errorf("%w: %s", errRuleMissingValue, name)
+			}
+			return value, nil
+		}}, nil
+	default:
+		return ruleNode{}, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+// parseRuleNumber reads a number of a rule, with optional "_" or "," separators and a k, m or b suffix.
+//
+// Parameters:
+//
+//	token (string): The number token, e.g. "80_000_000" or "300m".
+//
+// Returns:
+//
+//	float64: The value.
+//	error: An error if the number is invalid, otherwise nil.
+func parseRuleNumber(token string) (float64, error) {
+	scale := 1.0
+	if multiplier, ok := ruleSuffixes[token[len(token)-1]]; ok {
+		scale = multiplier
+		token = token[:len(token)-1]
+	}
+	value, err := strconv.ParseFloat(strings.NewReplacer("_", "", ",", "").Replace(token), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return value * scale, nil
+}
+
+// logicalNode combines two boolean nodes with && or ||.
+func logicalNode(operator string, left ruleNode, right ruleNode) (ruleNode, error) {
+	if !left.Bool || !right.Bool {
+		return ruleNode{}, fmt.Errorf("%s needs comparisons", operator)
+	}
+	return ruleNode{Bool: true, Eval: func(vars map[string]float64) (float64, error) {
+		a, err := left.Eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		if (operator == "&&") == (a == 0) {
+			// short circuit: false && x, true || x
+			return a, nil
+		}
+		return right.Eval(vars)
+	}}, nil
+}
+
+// arithmeticNode combines two numeric nodes with +, -, * or /.
+func arithmeticNode(operator string, left ruleNode, right ruleNode) (ruleNode, error) {
+	if left.Bool || right.Bool {
+		return ruleNode{}, fmt.Errorf("%s needs numbers", operator)
+	}
+	return ruleNode{Eval: func(vars map[string]float64) (float64, error) {
+		a, err := left.Eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		b, err := right.Eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		default:
+			if b == 0 {
+				return 0, errRuleDivisionByZero
+			}
+			return a / b, nil
+		}
+	}}, nil
+}
+
+// boolValue converts a boolean to the numeric value of boolean nodes.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compiledRule is the result of compiling the rule of an alert, kept by compiledRules.
+type compiledRule struct {
+	expression string
+	node       ruleNode
+	err        error
+}
+
+// compiledRules caches the compiled rule of each alert by the key of the alert, as every post
+// of an alert is checked against the same rule. It holds one entry per alert, which is
+// replaced when the rule of the alert changes and removed when the alert is deleted.
+var compiledRules sync.Map
+
+// cachedRule compiles the rule of an alert once and returns the cached result afterwards,
+// until the rule changes.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//
+// Returns:
+//
+//	ruleNode: The compiled boolean rule.
+//	error: An error if the rule is invalid, otherwise nil.
+func cachedRule(alert Alert) (ruleNode, error) {
+	key := string(alertKey(alert.Bot, alert.ChatId, alert.Id))
+	if cached, ok := compiledRules.Load(key); ok && cached.(compiledRule).expression == alert.Rule {
+		return cached.(compiledRule).node, cached.(compiledRule).err
+	}
+	node, err := compileRule(alert.Rule)
+	compiledRules.Store(key, compiledRule{expression: alert.Rule, node: node, err: err})
+	return node, err
+}
+
+// matchesRule reports whether a post passes the rule of an alert. A post whose values
+// cannot be computed, e.g. a price per meter of a post without an area, does not pass.
+//
+// Parameters:
+//
+//	alert (Alert): The alert.
+//	post (divar.PostWidget): The post.
+//
+// Returns:
+//
+//	bool: True if the alert has no rule or the post passes it, otherwise false.
+func matchesRule(alert Alert, post divar.PostWidget) bool {
+	if alert.Rule == "" {
+		return true
+	}
+	rule, err := cachedRule(alert)
+	if err != nil {
+		sugar.Errorw("Invalid alert rule", "error", err, "alert", alert.Title)
+		return true
+	}
+	value, err := rule.Eval(ruleVariables(post.Attributes()))
+	return err == nil && value != 0
+}
+
+// setAlertRule sets the numeric rule that the posts of an alert must pass.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): The rule, e.g. "price/area < 80m", or "off" to remove it.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the rule is invalid, otherwise nil.
+func setAlertRule(alert *Alert, value string) error {
+	if value == "off" {
+		alert.Rule = ""
+		return nil
+	}
+	if _, err := compileRule(value); err != nil {
+		return &ProcessInputError{Key: "edit.rule.invalid", Args: []any{err.Error()}}
+	}
+	alert.Rule = value
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"github.com/mrmohebi/divar-alert/divar"
+	"testing"
+)
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		vars map[string]float64
+		want bool
+	}{
+		{"price/area < 80_000_000", map[string]float64{"price": 7_000_000_000, "area": 80}, false},
+		{"price/area < 80_000_000", map[string]float64{"price": 5_000_000_000, "area": 80}, true},
+		{"price < 1,000,000", map[string]float64{"price": 999_999}, true},
+		{"deposit >= 300m && rent <= 10m", map[string]float64{"deposit": 300_000_000, "rent": 10_000_000}, true},
+		{"deposit >= 300m && rent <= 10m", map[string]float64{"deposit": 300_000_000, "rent": 10_000_001}, false},
+		{"price <= 1.5b", map[string]float64{"price": 1_500_000_000}, true},
+		{"area > 2k", map[string]float64{"area": 2_001}, true},
+		// * binds tighter than +, and comparisons tighter than && and ||
+		{"1 + 2 * 3 == 7", nil, true},
+		{"(1 + 2) * 3 == 9", nil, true},
+		{"10 - 4 - 3 == 3", nil, true},
+		{"8 / 4 / 2 == 1", nil, true},
+		{"-2 * 3 == -6", nil, true},
+		{"1 == 1 || 1 == 2 && 1 == 2", nil, true},
+		{"(1 == 1 || 1 == 2) && 1 == 2", nil, false},
+		{"!(area > 100)", map[string]float64{"area": 80}, true},
+		{"!area > 100 || area < 100", map[string]float64{"area": 80}, true},
+		{"!(area > 50) && area < 100", map[string]float64{"area": 80}, false},
+		{"PRICE > 0", map[string]float64{"price": 1}, true},
+	}
+	for _, test := range tests {
+		rule, err := compileRule(test.rule)
+		if err != nil {
+			t.Errorf("compileRule(%q) error = %v", test.rule, err)
+			continue
+		}
+		value, err := rule.Eval(test.vars)
+		if err != nil || (value != 0) != test.want {
+			t.Errorf("%q = %v, %v, want %v", test.rule, value, err, test.want)
+		}
+	}
+}
+
+func TestCompileRuleRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"price",
+		"price + 1",
+		"size > 10",
+		"price > ",
+		"(price > 1",
+		"price > 1)",
+		"price > 1 2",
+		"price >> 1",
+		"price > 1x",
+		"price > 1.2.3",
+		"price > 1 && 2",
+		"price > $1",
+	} {
+		if _, err := compileRule(rule); err == nil {
+			t.Errorf("compileRule(%q) succeeded, want an error", rule)
+		}
+	}
+}
+
+func TestRuleEvalErrors(t *testing.T) {
+	rule, err := compileRule("price/area < 80m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rule.Eval(map[string]float64{"price": 1, "area": 0}); !errors.Is(err, errRuleDivisionByZero) {
+		t.Errorf("dividing by zero: error = %v, want errRuleDivisionByZero", err)
+	}
+	if _, err := rule.Eval(map[string]float64{"price": 1}); !errors.Is(err, errRuleMissingValue) {
+		t.Errorf("missing area: error = %v, want errRuleMissingValue", err)
+	}
+}
+
+func TestMatchesRuleFailsOnMissingValues(t *testing.T) {
+	withArea := testPost("a", "آپارتمان ۸۰ متری")
+	withArea.Data.MiddleDescriptionText = "۵٬۰۰۰٬۰۰۰٬۰۰۰ تومان"
+	withoutArea := testPost("b", "آپارتمان")
+	withoutArea.Data.MiddleDescriptionText = "۵٬۰۰۰٬۰۰۰٬۰۰۰ تومان"
+	negotiable := testPost("c", "آپارتمان ۸۰ متری")
+	negotiable.Data.MiddleDescriptionText = "توافقی"
+
+	tests := []struct {
+		rule string
+		post divar.PostWidget
+		want bool
+	}{
+		{"price/area < 80m", withArea, true},
+		{"price/area < 80m", withoutArea, false},
+		{"price < 10b", negotiable, false},
+		// a missing value fails the rule even where 0 would pass it
+		{"!(area > 0)", withoutArea, false},
+		{"rent <= 10m", withArea, false},
+		{"", withoutArea, true},
+	}
+	for _, test := range tests {
+		if got := matchesRule(Alert{Rule: test.rule}, test.post); got != test.want {
+			t.Errorf("matchesRule(%q, %s) = %v, want %v", test.rule, test.post.Data.Token, got, test.want)
+		}
+	}
+}
+
+func TestCachedRule(t *testing.T) {
+	alert := Alert{Id: 1, ChatId: 10, Bot: "telegram", Rule: "area > 50"}
+	if _, err := cachedRule(alert); err != nil {
+		t.Fatal(err)
+	}
+	rule, _ := cachedRule(alert)
+	if value, err := rule.Eval(map[string]float64{"area": 60}); err != nil || value == 0 {
+		t.Errorf("cached rule = %v, %v, want a pass", value, err)
+	}
+	if cached, ok := compiledRules.Load(string(alertKey("telegram", 10, 1))); !ok || cached.(compiledRule).err != nil {
+		t.Error("the compiled rule is not cached")
+	}
+
+	// an edited rule replaces the cached one
+	alert.Rule = "area > 70"
+	rule, _ = cachedRule(alert)
+	if value, err := rule.Eval(map[string]float64{"area": 60}); err != nil || value != 0 {
+		t.Errorf("rule after the edit = %v, %v, want a fail", value, err)
+	}
+	alert.Rule = "area >"
+	if _, err := cachedRule(alert); err == nil {
+		t.Error("cachedRule of an invalid rule succeeded")
+	}
+	if _, err := cachedRule(alert); err == nil {
+		t.Error("cached invalid rule succeeded")
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/mrmohebi/divar-alert/divar"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// priceHistoryTTL is how long the parsed price of a post listed by an alert is kept.
+const priceHistoryTTL = 90 * 24 * time.Hour
+
+// statsWindows are the periods, in days, shown by /stats.
+var statsWindows = []int{7, 30}
+
+// priceKey builds the database key under which the parsed price of a post listed by an alert is stored.
+//
+// Parameters:
+//
+//	alertId (int64): The ID of the alert.
+//	token (string): The token of the post.
+//
+// Returns:
+//
+//	[]byte: The database key of the price record.
+func priceKey(alertId int64, token string) []byte {
+	return []byte(fmt.Sprintf("price-%d-%s", alertId, token))
+}
+
+// recordPrice stores the parsed price and area of a post listed by an alert. The time the
+// post was first listed is kept when its price changes.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alert (Alert): The alert that listed the post.
+//	post (divar.PostWidget): The post as currently listed.
+//
+// Returns:
+//
+//	error: An error if the operation fails, otherwise nil.
+func recordPrice(txn *badger.Txn, alert Alert, post divar.PostWidget) error {
+	key := priceKey(alert.Id, post.Data.Token)
+	record := PriceRecord{Token: post.Data.Token, SeenAt: time.Now().Unix(), PostAttributes: post.Attributes()}
+
+	item, err := txn.Get(key)
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	if err == nil {
+		var previous PriceRecord
+		err = item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &previous)
+		})
+		if err != nil {
+			return err
+		}
+		if previous.PostAttributes == record.PostAttributes {
+			return nil
+		}
+		record.SeenAt = previous.SeenAt
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return txn.SetEntry(badger.NewEntry(key, value).WithTTL(priceHistoryTTL))
+}
+
+// readPriceRecords reads the price records of the posts an alert listed since a time, oldest first.
+//
+// Parameters:
+//
+//	txn (*badger.Txn): The Badger transaction.
+//	alertId (int64): The ID of the alert.
+//	since (time.Time): The earliest time a post was first listed.
+//
+// Returns:
+//
+//	[]PriceRecord: The price records.
+//	error: An error if the records cannot be read, otherwise nil.
+func readPriceRecords(txn *badger.Txn, alertId int64, since time.Time) ([]PriceRecord, error) {
+	var records []PriceRecord
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(fmt.Sprintf("price-%d-", alertId))
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		var record PriceRecord
+		err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+		if err != nil {
+			sugar.Errorw("Failed to unmarshal price record", "error", err, "key", string(it.Item().Key()))
+			continue
+		}
+		if record.SeenAt >= since.Unix() {
+			records = append(records, record)
+		}
+	}
+	slices.SortFunc(records, func(a, b PriceRecord) int {
+		return cmp.Compare(a.SeenAt, b.SeenAt)
+	})
+	return records, nil
+}
+
+// alertPriceRecords reads the price records of the posts an alert listed since a time, oldest first.
+//
+// Parameters:
+//
+//	alertId (int64): The ID of the alert.
+//	since (time.Time): The earliest time a post was first listed.
+//
+// Returns:
+//
+//	[]PriceRecord: The price records.
+//	error: An error if the records cannot be read, otherwise nil.
+func alertPriceRecords(alertId int64, since time.Time) ([]PriceRecord, error) {
+	var records []PriceRecord
+	err := db.View(func(txn *badger.Txn) error {
+		var err error
+		records, err = readPriceRecords(txn, alertId, since)
+		return err
+	})
+	return records, err
+}
+
+// PricePerMeter returns the sale price of the post per square meter.
+//
+// Returns:
+//
+//	float64: The price per square meter in toman.
+//	bool: False if the post has no sale price or no area.
+func (r PriceRecord) PricePerMeter() (float64, bool) {
+	if r.Price <= 0 || r.Area <= 0 {
+		return 0, false
+	}
+	return float64(r.Price) / float64(r.Area), true
+}
+
+// amountStats summarizes a set of amounts.
+type amountStats struct {
+	Count  int
+	Median float64
+	Min    float64
+	Max    float64
+}
+
+// summarizeAmounts computes the median, minimum and maximum of a set of amounts.
+//
+// Parameters:
+//
+//	values ([]float64): The amounts, in any order.
+//
+// Returns:
+//
+//	amountStats: The summary, with a Count of 0 if there are no amounts.
+func summarizeAmounts(values []float64) amountStats {
+	if len(values) == 0 {
+		return amountStats{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	return amountStats{Count: len(sorted), Median: median, Min: sorted[0], Max: sorted[len(sorted)-1]}
+}
+
+// formatAmount formats an amount in toman with thousands separators.
+//
+// Parameters:
+//
+//	amount (float64): The amount.
+//
+// Returns:
+//
+//	string: The rounded amount, e.g. "2,500,000".
+func formatAmount(amount float64) string {
+	digits := strconv.FormatInt(int64(amount+0.5), 10)
+	var out strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+		out.WriteRune(digit)
+	}
+	return out.String()
+}
+
+// alertStats describes the posts an alert listed in the last days.
+//
+// Parameters:
+//
+//	records ([]PriceRecord): The price records of the alert, oldest first.
+//	days (int): The number of days described.
+//	now (time.Time): The current time.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	string: The description of the period.
+func alertStats(records []PriceRecord, days int, now time.Time, lang string) string {
+	since := now.AddDate(0, 0, -days).Unix()
+	count := 0
+	var prices, perMeter, deposits, rents []float64
+	for _, record := range records {
+		if record.SeenAt < since {
+			continue
+		}
+		count++
+		if record.Price > 0 {
+			prices = append(prices, float64(record.Price))
+		}
+		if value, ok := record.PricePerMeter(); ok {
+			perMeter = append(perMeter, value)
+		}
+		if record.Deposit > 0 {
+			deposits = append(deposits, float64(record.Deposit))
+		}
+		if record.Rent > 0 {
+			rents = append(rents, float64(record.Rent))
+		}
+	}
+
+	text := tr(lang, "stats.window", days, count, float64(count)/float64(days))
+	for _, line := range []struct {
+		Key    string
+		Values []float64
+	}{
+		{"stats.price", prices},
+		{"stats.perMeter", perMeter},
+		{"stats.deposit", deposits},
+		{"stats.rent", rents},
+	} {
+		stats := summarizeAmounts(line.Values)
+		if stats.Count == 0 {
+			continue
+		}
+		text += tr(lang, line.Key, formatAmount(stats.Median), formatAmount(stats.Min), formatAmount(stats.Max))
+	}
+	return text
+}
+
+// dailyCounts describes how many posts an alert listed on each of the last days.
+//
+// Parameters:
+//
+//	records ([]PriceRecord): The price records of the alert.
+//	days (int): The number of days described.
+//	now (time.Time): The current time.
+//	lang (string): The language of the chat.
+//
+// Returns:
+//
+//	string: The number of new posts of each day, oldest first.
+func dailyCounts(records []PriceRecord, days int, now time.Time, lang string) string {
+	counts := map[string]int{}
+	for _, record := range records {
+		counts[time.Unix(record.SeenAt, 0).In(tehran).Format(time.DateOnly)]++
+	}
+	var parts []string
+	today := now.In(tehran)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format(time.DateOnly)
+		parts = append(parts, fmt.Sprintf("%s: %d", day[5:], counts[day]))
+	}
+	return tr(lang, "stats.daily", strings.Join(parts, tr(lang, "list.separator")))
+}
+
+// alertByNumber finds an alert by its number in /alertList.
+//
+// Parameters:
+//
+//	alerts ([]Alert): The alerts of the chat, as listed by listAlerts.
+//	number (string): The number of the alert, starting at 1.
+//
+// Returns:
+//
+//	Alert: The alert.
+//	bool: False if the number is not the number of an alert.
+func alertByNumber(alerts []Alert, number string) (Alert, bool) {
+	i, err := strconv.Atoi(strings.TrimSpace(divar.NormalizeDigits(number)))
+	if err != nil || i < 1 || i > len(alerts) {
+		return Alert{}, false
+	}
+	return alerts[i-1], true
+}
+
+func handlerStats(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatId := update.Message.Chat.ID
+	lang := chatLang(botName(b), chatId)
+	alerts, err := listAlerts(botName(b), chatId)
+	if err != nil {
+		sugar.Errorw("Failed to list alerts", "error", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "stats.error"),
+		})
+		return
+	}
+	if len(alerts) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatId,
+			Text:   tr(lang, "alert.list.empty"),
+		})
+		return
+	}
+
+	if args := commandArgs(update.Message.Text); args != "" {
+		alert, ok := alertByNumber(alerts, args)
+		if !ok {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatId,
+				Text:   tr(lang, "stats.usage"),
+			})
+			return
+		}
+		alerts = []Alert{alert}
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -slices.Max(statsWindows))
+	var text string
+	for _, alert := range alerts {
+		records, err := alertPriceRecords(alert.Id, since)
+		if err != nil {
+			sugar.Errorw("Failed to read price records", "error", err, "alert", alert.Title)
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatId,
+				Text:   tr(lang, "stats.error"),
+			})
+			return
+		}
+
+		section := tr(lang, "stats.header", alert.Title)
+		if len(records) == 0 {
+			section += tr(lang, "stats.empty")
+		} else {
+			section += dailyCounts(records, statsWindows[0], now, lang)
+			for _, days := range statsWindows {
+				section += alertStats(records, days, now, lang)
+			}
+		}
+		if text != "" && textLength(text+section) > maxMessageLength {
+			b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatId, Text: text})
+			text = ""
+		}
+		text += section + "\n"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatId, Text: text})
+}
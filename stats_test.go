@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/mrmohebi/divar-alert/divar"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeAmounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   amountStats
+	}{
+		{"empty", nil, amountStats{}},
+		{"one", []float64{5}, amountStats{Count: 1, Median: 5, Min: 5, Max: 5}},
+		{"odd", []float64{30, 10, 20}, amountStats{Count: 3, Median: 20, Min: 10, Max: 30}},
+		{"even", []float64{40, 10, 30, 20}, amountStats{Count: 4, Median: 25, Min: 10, Max: 40}},
+		{"repeated", []float64{7, 7, 1, 7}, amountStats{Count: 4, Median: 7, Min: 1, Max: 7}},
+	}
+	for _, test := range tests {
+		if got := summarizeAmounts(test.values); got != test.want {
+			t.Errorf("%s: summarizeAmounts() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	values := []float64{3, 1, 2}
+	summarizeAmounts(values)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("summarizeAmounts sorted its argument: %v", values)
+	}
+}
+
+func TestAlertStats(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	record := func(daysAgo int, attributes divar.PostAttributes) PriceRecord {
+		return PriceRecord{Token: "t", SeenAt: now.AddDate(0, 0, -daysAgo).Unix(), PostAttributes: attributes}
+	}
+	records := []PriceRecord{
+		record(20, divar.PostAttributes{Price: 9_000_000_000, Area: 100}),
+		record(5, divar.PostAttributes{Price: 2_000_000_000, Area: 100}),
+		record(3, divar.PostAttributes{Price: 4_000_000_000, Area: 80}),
+		record(2, divar.PostAttributes{Deposit: 300_000_000, Rent: 10_000_000}),
+		record(1, divar.PostAttributes{PriceKind: divar.PriceKind.Negotiable}),
+	}
+
+	tests := []struct {
+		name string
+		days int
+		want []string
+		not  []string
+	}{
+		{
+			name: "week",
+			days: 7,
+			want: []string{
+				"Last 7 days: 4 posts (0.6 per day)",
+				"Price: median 3,000,000,000, min 2,000,000,000, max 4,000,000,000",
+				"Price per m²: median 35,000,000, min 20,000,000, max 50,000,000",
+				"Deposit: median 300,000,000",
+				"Rent: median 10,000,000",
+			},
+		},
+		{
+			name: "month",
+			days: 30,
+			want: []string{"Last 30 days: 5 posts", "Price: median 4,000,000,000, min 2,000,000,000, max 9,000,000,000"},
+		},
+		{
+			name: "day without prices",
+			days: 1,
+			want: []string{"Last 1 days: 1 posts (1.0 per day)"},
+			not:  []string{"Price", "Deposit", "Rent"},
+		},
+	}
+	for _, test := range tests {
+		text := alertStats(records, test.days, now, "en")
+		for _, want := range test.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: alertStats() = %q, want it to contain %q", test.name, text, want)
+			}
+		}
+		for _, not := range test.not {
+			if strings.Contains(text, not) {
+				t.Errorf("%s: alertStats() = %q, want no %q", test.name, text, not)
+			}
+		}
+	}
+}
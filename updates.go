@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookServerConfig holds the settings of webhook mode, where the bot API pushes
+// updates to an embedded HTTP server instead of the bots polling for them.
+//
+// Fields:
+//
+//	PublicURL (string): The public base URL at which the HTTP server is reachable, e.g. through a reverse proxy.
+//	Listen (string): The address the HTTP server listens on.
+//	Path (string): The path at which updates are received.
+//	Secret (string): The token the bot API sends with every update.
+type WebhookServerConfig struct {
+	PublicURL string
+	Listen    string
+	Path      string
+	Secret    string
+}
+
+// loadWebhookServerConfig reads the webhook mode settings from the environment.
+//
+// Returns:
+//
+//	*WebhookServerConfig: The settings, or nil if WEBHOOK_URL is not set and long polling is used.
+//	error: An error if the settings are invalid, otherwise nil.
+func loadWebhookServerConfig() (*WebhookServerConfig, error) {
+	publicURL := os.Getenv("WEBHOOK_URL")
+	if publicURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("WEBHOOK_URL must be an https URL")
+	}
+
+	config := &WebhookServerConfig{
+		PublicURL: strings.TrimSuffix(publicURL, "/"),
+		Listen:    os.Getenv("WEBHOOK_LISTEN"),
+		Path:      os.Getenv("WEBHOOK_PATH"),
+		Secret:    os.Getenv("WEBHOOK_SECRET"),
+	}
+	if config.Listen == "" {
+		config.Listen = ":8080"
+	}
+	if config.Path == "" {
+		config.Path = "/webhook"
+	}
+	config.Path = "/" + strings.Trim(config.Path, "/")
+	if config.Secret == "" {
+		// the webhook is registered again on every start, so a random secret is enough
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		config.Secret = hex.EncodeToString(secret)
+	}
+	for _, c := range config.Secret {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return nil, errors.New("WEBHOOK_SECRET may only contain A-Z, a-z, 0-9, _ and -")
+		}
+	}
+	return config, nil
+}
+
+// webhookSecret returns the secret token the bots expect with webhook updates.
+//
+// Parameters:
+//
+//	config (*WebhookServerConfig): The webhook mode settings, nil when long polling is used.
+//
+// Returns:
+//
+//	string: The secret token, or an empty string when long polling is used.
+func webhookSecret(config *WebhookServerConfig) string {
+	if config == nil {
+		return ""
+	}
+	return config.Secret
+}
+
+// webhookPath returns the path at which a bot receives its updates. With several
+// bots, each one gets its own path below the configured one.
+//
+// Parameters:
+//
+//	config (*WebhookServerConfig): The webhook mode settings.
+//	instance (*botInstance): The bot.
+//
+// Returns:
+//
+//	string: The path of the bot.
+func webhookPath(config *WebhookServerConfig, instance *botInstance) string {
+	if len(bots) == 1 {
+		return config.Path
+	}
+	return config.Path + "/" + url.PathEscape(instance.Name)
+}
+
+// verifySecret rejects requests that do not carry the webhook secret token.
+//
+// Parameters:
+//
+//	secret (string): The expected secret token.
+//	next (http.Handler): The handler of verified requests.
+//
+// Returns:
+//
+//	http.Handler: The verifying handler.
+func verifySecret(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runWebhookServer registers the webhook of every bot, serves their updates until
+// the context is cancelled or the server fails, and then removes the webhooks again.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context that stops the server.
+//	config (*WebhookServerConfig): The webhook mode settings.
+//
+// Returns:
+//
+//	error: An error if a webhook cannot be registered or the server fails, otherwise nil.
+func runWebhookServer(ctx context.Context, config *WebhookServerConfig) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mux := http.NewServeMux()
+	for _, instance := range bots {
+		path := webhookPath(config, instance)
+		mux.Handle(path, verifySecret(config.Secret, instance.Bot.WebhookHandler()))
+
+		_, err := instance.Bot.SetWebhook(ctx, &bot.SetWebhookParams{
+			URL:         config.PublicURL + path,
+			SecretToken: config.Secret,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set webhook of bot %s: %w", instance.Name, err)
+		}
+		sugar.Infow("Webhook set", "bot", instance.Name, "url", config.PublicURL+path)
+	}
+
+	var wg sync.WaitGroup
+	for _, instance := range bots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance.Bot.StartWebhook(ctx)
+		}()
+	}
+
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		deleteWebhooks(shutdownCtx)
+		server.Shutdown(shutdownCtx)
+	}()
+
+	sugar.Infow("Listening for webhook updates", "address", config.Listen)
+	err := server.ListenAndServe()
+	// a server that fails, e.g. when its address is in use, still stops the bots and removes the webhooks
+	cancel()
+	wg.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// deleteWebhooks removes the webhook of every bot, so they can be used with long polling.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the requests.
+func deleteWebhooks(ctx context.Context) {
+	for _, instance := range bots {
+		if _, err := instance.Bot.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+			sugar.Errorw("Failed to delete webhook", "error", err, "bot", instance.Name)
+		}
+	}
+}
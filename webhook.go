@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mrmohebi/divar-alert/divar"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// WebhookSignatureHeader is the header carrying the HMAC-SHA256 signature of a webhook body.
+const WebhookSignatureHeader = "X-Divar-Alert-Signature"
+
+// WebhookPayload is the JSON document posted to a webhook for every new post.
+type WebhookPayload struct {
+	AlertId           int64                `json:"alertId"`
+	AlertTitle        string               `json:"alertTitle"`
+	Token             string               `json:"token"`
+	URL               string               `json:"url"`
+	Title             string               `json:"title"`
+	ImageURL          string               `json:"imageUrl"`
+	TopDescription    string               `json:"topDescription"`
+	MiddleDescription string               `json:"middleDescription"`
+	BottomDescription string               `json:"bottomDescription"`
+	Price             string               `json:"price"`
+	Attributes        divar.PostAttributes `json:"attributes"`
+	Deal              *DealScore           `json:"deal,omitempty"`
+	SentAt            int64                `json:"sentAt"`
+}
+
+// newWebhookPayload builds the webhook document of a notification.
+//
+// Parameters:
+//
+//	notification (PostNotification): The notification.
+//
+// Returns:
+//
+//	WebhookPayload: The webhook document.
+func newWebhookPayload(notification PostNotification) WebhookPayload {
+	post := notification.Post
+	return WebhookPayload{
+		AlertId:           notification.Alert.Id,
+		AlertTitle:        notification.Alert.Title,
+		Token:             post.Data.Token,
+		URL:               postURL(post.Data.Token),
+		Title:             post.Data.Title,
+		ImageURL:          post.Data.ImageURL,
+		TopDescription:    post.Data.TopDescriptionText,
+		MiddleDescription: post.Data.MiddleDescriptionText,
+		BottomDescription: post.Data.BottomDescriptionText,
+		Price:             postPrice(post),
+		Attributes:        post.Attributes(),
+		Deal:              notification.Deal,
+		SentAt:            time.Now().Unix(),
+	}
+}
+
+// signWebhook computes the signature of a webhook body.
+//
+// Parameters:
+//
+//	secret (string): The webhook secret of the alert.
+//	body ([]byte): The request body.
+//
+// Returns:
+//
+//	string: The signature in the form "sha256=<hex digest>".
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errWebhookUnsigned is returned when a webhook request would be sent without a signature.
+var errWebhookUnsigned = fmt.Errorf("%w: webhook has no secret", errUndeliverable)
+
+// minWebhookSecretLength is the length of the shortest webhook secret a user can choose.
+const minWebhookSecretLength = 16
+
+// newWebhookSecret generates a random webhook secret.
+//
+// Returns:
+//
+//	string: 32 random bytes in hex.
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+// errWebhookAddress is returned when a webhook would reach an address of the host or its network.
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routable on the internet.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress reports whether an IP address may be reached by a webhook. Loopback,
+// private, link-local and unspecified addresses would let an alert probe the host of
+// the bot and its network.
+//
+// Parameters:
+//
+//	addr (netip.Addr): The IP address.
+//
+// Returns:
+//
+//	bool: True if the address is public, otherwise false.
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// webhookDialControl refuses connections to addresses that are not public. It runs
+// after the host name is resolved, so a name that resolves to another address when
+// the request is sent, or a redirect, cannot reach the host of the bot either.
+//
+// Parameters:
+//
+//	network (string): The network of the connection.
+//	address (string): The resolved "ip:port" address.
+//	c (syscall.RawConn): The connection, unused.
+//
+// Returns:
+//
+//	error: An error if the address is not public, otherwise nil.
+func webhookDialControl(network string, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// newWebhookClient creates the HTTP client of webhook requests, which only connects to public addresses.
+//
+// Returns:
+//
+//	*http.Client: The client.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: webhookDialControl}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+	}
+}
+
+// WebhookNotifier delivers notifications by posting a signed JSON document to the URL of the recipient.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, recipient Recipient, notification PostNotification) error {
+	body, err := json.Marshal(newWebhookPayload(notification))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, recipient.Address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	secret := notification.Alert.WebhookSecret
+	if secret == "" {
+		return errWebhookUnsigned
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "divar-alert")
+	req.Header.Set(WebhookSignatureHeader, signWebhook(secret, body))
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook responded with %s", res.Status)
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		if seconds, convErr := strconv.Atoi(res.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+			return &RetryLaterError{After: time.Duration(seconds) * time.Second, Err: err}
+		}
+	}
+	return err
+}
+
+// setAlertWebhook sets the webhook URL of an alert. An alert without a webhook secret gets a
+// random one, as webhook requests are always signed.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): An http or https URL, or "off" to remove the webhook.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the URL is invalid or does not reach a public address, otherwise nil.
+func setAlertWebhook(alert *Alert, value string) error {
+	if value == "off" {
+		alert.WebhookURL = ""
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return &ProcessInputError{Key: "edit.webhook.invalid"}
+	}
+	addrs, err := lookupWebhookHost(u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return &ProcessInputError{Key: "edit.webhook.unresolved"}
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr) {
+			return &ProcessInputError{Key: "edit.webhook.private"}
+		}
+	}
+	alert.WebhookURL = value
+	if alert.WebhookSecret == "" {
+		alert.WebhookSecret = newWebhookSecret()
+	}
+	return nil
+}
+
+// lookupWebhookHost resolves the host of a webhook URL.
+//
+// Parameters:
+//
+//	host (string): A host name or an IP address.
+//
+// Returns:
+//
+//	[]netip.Addr: The addresses of the host.
+//	error: An error if the host cannot be resolved, otherwise nil.
+func lookupWebhookHost(host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// setAlertWebhookSecret sets the secret used to sign the webhook requests of an alert.
+//
+// Parameters:
+//
+//	alert (*Alert): The alert.
+//	value (string): The secret, or "new" to generate a random one.
+//
+// Returns:
+//
+//	error: A *ProcessInputError if the secret is too short, otherwise nil.
+func setAlertWebhookSecret(alert *Alert, value string) error {
+	if value == "new" {
+		alert.WebhookSecret = newWebhookSecret()
+		return nil
+	}
+	if len(value) < minWebhookSecretLength {
+		return &ProcessInputError{Key: "edit.webhookSecret.invalid", Args: []any{minWebhookSecretLength}}
+	}
+	alert.WebhookSecret = value
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookNotifierSignsBody(t *testing.T) {
+	type request struct {
+		body      []byte
+		signature string
+		mediaType string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{body: body, signature: r.Header.Get(WebhookSignatureHeader), mediaType: r.Header.Get("Content-Type")}
+	}))
+	defer server.Close()
+
+	post := testPost("abc", "flat")
+	post.Data.MiddleDescriptionText = "۸۰۰٬۰۰۰٬۰۰۰ تومان"
+	notification := PostNotification{
+		Alert: Alert{Id: 7, Title: "flats", WebhookURL: server.URL, WebhookSecret: "s3cret"},
+		Post:  post,
+	}
+	notifier := &WebhookNotifier{Client: server.Client()}
+	if err := notifier.Send(context.Background(), Recipient{Channel: Channel.Webhook, Address: server.URL}, notification); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-requests
+	if got.mediaType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got.mediaType)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(got.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.signature != want {
+		t.Errorf("%s = %q, want %q", WebhookSignatureHeader, got.signature, want)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.AlertId != 7 || payload.AlertTitle != "flats" || payload.Token != "abc" || payload.Title != "flat" {
+		t.Errorf("payload = %+v, want the alert and the post", payload)
+	}
+	if payload.URL != postURL("abc") || payload.Price != "۸۰۰٬۰۰۰٬۰۰۰ تومان" {
+		t.Errorf("payload URL and price = %q, %q", payload.URL, payload.Price)
+	}
+}
+
+func TestWebhookNotifierRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: server.Client()}
+	notification := PostNotification{Alert: Alert{WebhookSecret: "s3cret"}, Post: testPost("abc", "flat")}
+	err := notifier.Send(context.Background(), Recipient{Channel: Channel.Webhook, Address: server.URL}, notification)
+	if delay := retryAfter(err); delay.Seconds() != 30 {
+		t.Errorf("retryAfter() = %v, want 30s", delay)
+	}
+}
+
+func TestSetAlertWebhookRejectsLocalAddresses(t *testing.T) {
+	tests := []struct {
+		url string
+		key string
+	}{
+		{"https://93.184.215.14/hook", ""},
+		{"http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:8080/hook", ""},
+		{"ftp://93.184.215.14/hook", "edit.webhook.invalid"},
+		{"http://127.0.0.1:8080/hook", "edit.webhook.private"},
+		{"http://localhost/hook", "edit.webhook.private"},
+		{"http://[::1]/hook", "edit.webhook.private"},
+		{"http://10.1.2.3/hook", "edit.webhook.private"},
+		{"http://172.16.0.1/hook", "edit.webhook.private"},
+		{"http://192.168.1.1/hook", "edit.webhook.private"},
+		{"http://100.64.0.1/hook", "edit.webhook.private"},
+		{"http://169.254.169.254/latest/meta-data", "edit.webhook.private"},
+		{"http://[fe80::1]/hook", "edit.webhook.private"},
+		{"http://[::ffff:127.0.0.1]/hook", "edit.webhook.private"},
+		{"http://0.0.0.0/hook", "edit.webhook.private"},
+	}
+	for _, test := range tests {
+		var alert Alert
+		err := setAlertWebhook(&alert, test.url)
+		var inputErr *ProcessInputError
+		switch {
+		case test.key == "" && err != nil:
+			t.Errorf("setAlertWebhook(%q) error = %v, want nil", test.url, err)
+		case test.key != "" && (!errors.As(err, &inputErr) || inputErr.Key != test.key):
+			t.Errorf("setAlertWebhook(%q) error = %v, want %s", test.url, err, test.key)
+		case test.key != "" && alert.WebhookURL != "":
+			t.Errorf("setAlertWebhook(%q) kept the URL", test.url)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLocalAddresses(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: newWebhookClient()}
+	notification := PostNotification{Alert: Alert{WebhookSecret: "s3cret"}, Post: testPost("abc", "flat")}
+	err := notifier.Send(context.Background(), Recipient{Channel: Channel.Webhook, Address: server.URL}, notification)
+	if !errors.Is(err, errWebhookAddress) {
+		t.Errorf("Send() error = %v, want errWebhookAddress", err)
+	}
+	if requested {
+		t.Error("the request reached the local server")
+	}
+}
+
+func TestWebhookNotifierRefusesUnsignedRequests(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: server.Client()}
+	err := notifier.Send(context.Background(), Recipient{Channel: Channel.Webhook, Address: server.URL}, PostNotification{Post: testPost("abc", "flat")})
+	if !errors.Is(err, errUndeliverable) {
+		t.Errorf("Send() error = %v, want errUndeliverable", err)
+	}
+	if requested {
+		t.Error("an unsigned request was sent")
+	}
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	var alert Alert
+	if err := setAlertWebhook(&alert, "https://93.184.215.14/hook"); err != nil {
+		t.Fatal(err)
+	}
+	generated := alert.WebhookSecret
+	if len(generated) != 64 {
+		t.Fatalf("generated secret %q, want 32 bytes in hex", generated)
+	}
+	if err := setAlertWebhook(&alert, "https://93.184.215.14/other"); err != nil || alert.WebhookSecret != generated {
+		t.Errorf("changing the URL replaced the secret %q with %q", generated, alert.WebhookSecret)
+	}
+
+	for _, value := range []string{"off", "short"} {
+		err := setAlertWebhookSecret(&alert, value)
+		var inputErr *ProcessInputError
+		if !errors.As(err, &inputErr) || alert.WebhookSecret != generated {
+			t.Errorf("setAlertWebhookSecret(%q) error = %v, secret %q, want the secret kept", value, err, alert.WebhookSecret)
+		}
+	}
+	if err := setAlertWebhookSecret(&alert, "new"); err != nil || alert.WebhookSecret == generated || len(alert.WebhookSecret) != 64 {
+		t.Errorf("setAlertWebhookSecret(new) = %v, secret %q, want a new random secret", err, alert.WebhookSecret)
+	}
+	if err := setAlertWebhookSecret(&alert, "a-secret-of-my-own"); err != nil || alert.WebhookSecret != "a-secret-of-my-own" {
+		t.Errorf("setAlertWebhookSecret() = %v, secret %q", err, alert.WebhookSecret)
+	}
+}